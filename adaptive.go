@@ -0,0 +1,186 @@
+package retryhttp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveMinRate is the lowest send rate, in attempts per second, the
+	// adaptive mode throttles a host down to.
+	adaptiveMinRate = 0.5
+
+	// adaptiveDecrease scales the send rate down on every throttling response.
+	adaptiveDecrease = 0.7
+
+	// adaptiveIncrease scales the send rate up on every successful response.
+	adaptiveIncrease = 1.1
+
+	// adaptiveRelease is how far above the measured rate of the client the
+	// allowed rate has to grow before throttling stops altogether.
+	adaptiveRelease = 2.0
+)
+
+// WithAdaptiveRetry turns on adaptive mode, similar to the adaptive retry
+// mode of the AWS SDKs. The client measures its send rate to each host, and
+// when a host answers with 429 or 503, it limits the rate of attempts to
+// that host below what it was sending. Each successful response, as decided
+// by the retry condition, raises the limit again, until it is lifted once the
+// client no longer comes close to it.
+func WithAdaptiveRetry() Option {
+	return func(cfg *config) error {
+		cfg.adaptive = &adaptiveLimiter{}
+		return nil
+	}
+}
+
+// AdaptiveRate returns the send rate, in attempts per second, that adaptive
+// mode currently allows to host. It returns zero if the host is not being
+// throttled or adaptive mode is off.
+func (c *Client) AdaptiveRate(host string) float64 {
+	al := c.cfg.Load().adaptive
+	if al == nil {
+		return 0
+	}
+	v, ok := al.hosts.Load(host)
+	if !ok {
+		return 0
+	}
+	ah := v.(*adaptiveHost)
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+	return ah.rate
+}
+
+// adaptiveLimiter holds the adaptive state of every host.
+type adaptiveLimiter struct {
+	hosts sync.Map // map[string]*adaptiveHost
+}
+
+// adaptiveHost is the adaptive state of a single host. While rate is zero,
+// attempts are not limited.
+type adaptiveHost struct {
+	mu sync.Mutex
+
+	// Allowed rate, as a token bucket holding up to one second of attempts.
+	rate   float64
+	tokens float64
+	last   time.Time
+
+	// Measured send rate, smoothed over one second windows.
+	measured    float64
+	windowStart time.Time
+	windowCount int
+}
+
+func (al *adaptiveLimiter) host(host string) *adaptiveHost {
+	if ah, ok := al.hosts.Load(host); ok {
+		return ah.(*adaptiveHost)
+	}
+	ah, _ := al.hosts.LoadOrStore(host, &adaptiveHost{})
+	return ah.(*adaptiveHost)
+}
+
+// wait blocks until an attempt to host is allowed.
+func (al *adaptiveLimiter) wait(ctx context.Context, cfg *config, host string) error {
+	d := al.host(host).reserve(cfg.clock.Now())
+	if d <= 0 {
+		return nil
+	}
+	return cfg.sleep(ctx, d)
+}
+
+// observe adjusts the allowed rate of host from the outcome of an attempt,
+// where retry is what the retry condition decided for it.
+func (al *adaptiveLimiter) observe(cfg *config, host string, resp *http.Response, retry bool) {
+	ah := al.host(host)
+	now := cfg.clock.Now()
+
+	switch {
+	case resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable):
+		ah.throttled(now)
+	case !retry:
+		ah.succeeded(now)
+	}
+}
+
+// reserve records an attempt and, if the host is throttled, takes a token,
+// returning how long to wait for it.
+func (ah *adaptiveHost) reserve(now time.Time) time.Duration {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	ah.measure(now)
+	if ah.rate == 0 {
+		return 0
+	}
+
+	if elapsed := now.Sub(ah.last); elapsed > 0 {
+		ah.tokens = min(max(ah.rate, 1), ah.tokens+elapsed.Seconds()*ah.rate)
+	}
+	ah.last = now
+
+	ah.tokens--
+	if ah.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-ah.tokens / ah.rate * float64(time.Second))
+}
+
+// measure counts an attempt into the send rate measurement.
+func (ah *adaptiveHost) measure(now time.Time) {
+	if ah.windowStart.IsZero() {
+		ah.windowStart = now
+	}
+	if elapsed := now.Sub(ah.windowStart); elapsed >= time.Second {
+		current := float64(ah.windowCount) / elapsed.Seconds()
+		if ah.measured == 0 {
+			ah.measured = current
+		} else {
+			ah.measured = (ah.measured + current) / 2
+		}
+		ah.windowStart = now
+		ah.windowCount = 0
+	}
+	ah.windowCount++
+}
+
+// sendRate returns the best estimate of the current send rate.
+func (ah *adaptiveHost) sendRate(now time.Time) float64 {
+	if ah.measured > 0 {
+		return ah.measured
+	}
+	elapsed := max(now.Sub(ah.windowStart), time.Second)
+	return float64(ah.windowCount) / elapsed.Seconds()
+}
+
+func (ah *adaptiveHost) throttled(now time.Time) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	base := ah.rate
+	if base == 0 {
+		// First throttle: start from what the client was sending, with a
+		// single token so the next attempt is spaced out too.
+		base = ah.sendRate(now)
+		ah.tokens = 0
+		ah.last = now
+	}
+	ah.rate = max(adaptiveMinRate, base*adaptiveDecrease)
+	ah.tokens = min(ah.tokens, max(ah.rate, 1))
+}
+
+func (ah *adaptiveHost) succeeded(now time.Time) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	if ah.rate == 0 {
+		return
+	}
+	ah.rate *= adaptiveIncrease
+	if ah.rate >= adaptiveRelease*ah.sendRate(now) {
+		ah.rate = 0
+	}
+}
@@ -0,0 +1,97 @@
+package retryhttp_test
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WithAdaptiveRetry(t *testing.T) {
+	steps := retryhttptest.Repeat(10, retryhttptest.Step{})
+	steps = append(steps, retryhttptest.Step{Status: http.StatusTooManyRequests}, retryhttptest.Step{})
+	srv := retryhttptest.NewServer(steps...)
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	clock := retryhttptest.NewFakeClock(time.Now())
+	client := retryhttp.New(
+		retryhttp.WithClient(srv.Client()),
+		retryhttp.WithClock(clock),
+		retryhttp.WithMaxRetries(0),
+		retryhttp.WithAdaptiveRetry(),
+	)
+
+	get := func() {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	// Ten requests within the same second go through unthrottled.
+	for i := 0; i < 10; i++ {
+		get()
+	}
+	if got := client.AdaptiveRate(host); got != 0 {
+		t.Fatalf("expected no throttling yet, got rate %v", got)
+	}
+
+	// The 11th is throttled: the client was sending 11 requests per second,
+	// so it slows down to 70% of that.
+	get()
+	rate := client.AdaptiveRate(host)
+	if math.Abs(rate-7.7) > 0.001 {
+		t.Fatalf("expected rate 7.7, got %v", rate)
+	}
+
+	// The next request has to wait for its token.
+	done := make(chan struct{})
+	go func() {
+		get()
+		close(done)
+	}()
+	clock.BlockUntil(1)
+	wait := clock.AdvanceToNext()
+	<-done
+	if expected := time.Duration(float64(time.Second) / rate); (wait - expected).Abs() > time.Microsecond {
+		t.Fatalf("expected to wait %v, got %v", expected, wait)
+	}
+	if got := client.AdaptiveRate(host); got <= rate {
+		t.Fatalf("expected the success to raise the rate above %v, got %v", rate, got)
+	}
+
+	// Once the client sends far below the allowed rate, throttling stops.
+	clock.Advance(10 * time.Second)
+	get()
+	if got := client.AdaptiveRate(host); got != 0 {
+		t.Fatalf("expected throttling to be lifted, got rate %v", got)
+	}
+	srv.AssertAttempts(t, 13)
+}
+
+func TestClient_WithAdaptiveRetry_ConditionRunsOnce(t *testing.T) {
+	srv := retryhttptest.NewServer()
+	defer srv.Close()
+
+	calls := 0
+	client := retryhttp.New(
+		retryhttp.WithClient(srv.Client()),
+		retryhttp.WithAdaptiveRetry(),
+		retryhttp.WithCondition(func(resp *http.Response, err error) bool {
+			calls++
+			return retryhttp.DefaultRetryCondition(resp, err)
+		}),
+	)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Fatalf("expected the condition to run once per attempt, got %d calls", calls)
+	}
+}
@@ -0,0 +1,102 @@
+package retryhttp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenFetchTimeout limits how long a token source may take to return a
+// token, since a refresh no longer depends on the request that started it.
+const tokenFetchTimeout = time.Minute
+
+// TokenSource fetches bearer tokens. Token is called for the first request,
+// and again whenever the server rejects the current token with 401
+// Unauthorized, so it should return a fresh token every time.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token calls f.
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// WithTokenSource makes every attempt carry an "Authorization: Bearer"
+// header with the current token from ts. When a response is 401
+// Unauthorized, the token is refreshed and the request is sent again, right
+// away and without counting as a retry. Concurrent requests rejected with
+// the same token share a single refresh. The refresh is not canceled along
+// with the request that started it, but is given a minute at most. If the
+// request is rejected again with the new token, the 401 response is returned
+// as it is.
+func WithTokenSource(ts TokenSource) Option {
+	return func(cfg *config) error {
+		if ts == nil {
+			return invalidOption("WithTokenSource", "token source must not be nil")
+		}
+		cfg.tokens = &tokenCache{source: ts}
+		return nil
+	}
+}
+
+// tokenCache holds the current token and the refresh in progress, if any.
+type tokenCache struct {
+	source TokenSource
+
+	mu       sync.Mutex
+	token    string
+	fetching *tokenFetch
+}
+
+// tokenFetch is a refresh in progress. Its result is set before done is
+// closed.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// current returns the cached token, unless there is none yet or it is
+// stale, the token that was just rejected. Then it starts fetching a new
+// one, unless another request already did, and waits for the result.
+func (tc *tokenCache) current(ctx context.Context, stale string) (string, error) {
+	tc.mu.Lock()
+	f := tc.fetching
+	if f == nil {
+		if tc.token != "" && tc.token != stale {
+			token := tc.token
+			tc.mu.Unlock()
+			return token, nil
+		}
+		f = &tokenFetch{done: make(chan struct{})}
+		tc.fetching = f
+		go tc.fetch(context.WithoutCancel(ctx), f)
+	}
+	tc.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// fetch gets a new token from the source and publishes it through f.
+func (tc *tokenCache) fetch(ctx context.Context, f *tokenFetch) {
+	ctx, cancel := context.WithTimeout(ctx, tokenFetchTimeout)
+	defer cancel()
+	f.token, f.err = tc.source.Token(ctx)
+
+	tc.mu.Lock()
+	tc.fetching = nil
+	if f.err == nil {
+		tc.token = f.token
+	}
+	tc.mu.Unlock()
+	close(f.done)
+}
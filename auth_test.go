@@ -0,0 +1,174 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+// tokenServer accepts only the latest token issued by its token source.
+type tokenServer struct {
+	*httptest.Server
+	issued   atomic.Int32
+	attempts atomic.Int32
+	reject   atomic.Bool
+}
+
+func newTokenServer() *tokenServer {
+	ts := &tokenServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.attempts.Add(1)
+		if ts.reject.Load() || r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", ts.issued.Load()) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	return ts
+}
+
+func (ts *tokenServer) source() retryhttp.TokenSource {
+	return retryhttp.TokenSourceFunc(func(context.Context) (string, error) {
+		return fmt.Sprintf("token-%d", ts.issued.Add(1)), nil
+	})
+}
+
+func TestClient_WithTokenSource(t *testing.T) {
+	t.Run("Concurrent callers share a single refresh", func(t *testing.T) {
+		srv := newTokenServer()
+		defer srv.Close()
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithMaxRetries(0),
+			retryhttp.WithTokenSource(srv.source()),
+		)
+
+		resp, err := client.Get(srv.URL)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the first token to be accepted, got %v, %v", resp, err)
+		}
+		resp.Body.Close()
+
+		// Expire the current token on the server side.
+		srv.issued.Add(1)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(srv.URL)
+				if err != nil {
+					t.Errorf("expected no error, got: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("expected status 200 after the refresh, got %d", resp.StatusCode)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// One token for the first request, one skipped by the server, and a
+		// single refresh.
+		if got := srv.issued.Load(); got != 3 {
+			t.Fatalf("expected a single refresh, got %d tokens issued", got)
+		}
+	})
+
+	t.Run("A 401 after a refresh is final", func(t *testing.T) {
+		srv := newTokenServer()
+		defer srv.Close()
+		srv.reject.Store(true)
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithMaxRetries(3),
+			retryhttp.WithTokenSource(srv.source()),
+		)
+
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected status 401, got %d", resp.StatusCode)
+		}
+		if got := srv.attempts.Load(); got != 2 {
+			t.Fatalf("expected 2 attempts, got %d", got)
+		}
+	})
+
+	t.Run("A refresh outlives the request that started it", func(t *testing.T) {
+		srv := newTokenServer()
+		defer srv.Close()
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var fetchErr error
+		var calls atomic.Int32
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithTokenSource(retryhttp.TokenSourceFunc(func(ctx context.Context) (string, error) {
+				calls.Add(1)
+				close(started)
+				<-release
+				fetchErr = ctx.Err()
+				return fmt.Sprintf("token-%d", srv.issued.Add(1)), nil
+			})),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.Do(req)
+			errc <- err
+		}()
+		<-started
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled for the canceled request, got: %v", err)
+		}
+
+		// The refresh is still in progress: this request waits for it.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Errorf("expected no error, got: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected status 200, got %d", resp.StatusCode)
+			}
+		}()
+		close(release)
+		<-done
+
+		if fetchErr != nil {
+			t.Fatalf("expected the refresh not to be canceled, got: %v", fetchErr)
+		}
+		if got := calls.Load(); got != 1 {
+			t.Fatalf("expected a single refresh, got %d", got)
+		}
+	})
+
+	t.Run("Token errors are returned", func(t *testing.T) {
+		errNoToken := errors.New("no token")
+		client := retryhttp.New(retryhttp.WithTokenSource(retryhttp.TokenSourceFunc(func(context.Context) (string, error) {
+			return "", errNoToken
+		})))
+		if _, err := client.Get("http://example.invalid"); !errors.Is(err, errNoToken) {
+			t.Fatalf("expected the token error, got: %v", err)
+		}
+	})
+}
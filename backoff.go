@@ -0,0 +1,88 @@
+package retryhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackoffStrategy selects how the wait between attempts grows.
+type BackoffStrategy string
+
+const (
+	// BackoffExponential multiplies the wait by the backoff multiplier after
+	// every attempt. This is the default.
+	BackoffExponential BackoffStrategy = "exponential"
+
+	// BackoffLinear adds the initial backoff to the wait after every attempt.
+	BackoffLinear BackoffStrategy = "linear"
+
+	// BackoffConstant always waits for the initial backoff.
+	BackoffConstant BackoffStrategy = "constant"
+)
+
+// valid reports whether s is a known strategy.
+func (s BackoffStrategy) valid() bool {
+	switch s {
+	case BackoffExponential, BackoffLinear, BackoffConstant:
+		return true
+	}
+	return false
+}
+
+// nextBackoff returns the wait that follows current under the client's
+// strategy, capped at the maximum backoff.
+func (cfg *config) nextBackoff(current time.Duration) time.Duration {
+	var next time.Duration
+	switch cfg.backoffStrategy {
+	case BackoffConstant:
+		next = cfg.initialBackoff
+	case BackoffLinear:
+		next = current + cfg.initialBackoff
+	default:
+		next = time.Duration(float64(current) * cfg.backoffMultiplier)
+	}
+	if next > cfg.maxBackoff {
+		next = cfg.maxBackoff
+	}
+	return next
+}
+
+// RetryOnStatuses returns a RetryConditionFunc that retries on network errors
+// and on any of the given status codes.
+func RetryOnStatuses(codes ...int) RetryConditionFunc {
+	set := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return func(resp *http.Response, err error) bool {
+		if err != nil {
+			return true
+		}
+		return resp != nil && set[resp.StatusCode]
+	}
+}
+
+// retryAfter returns the wait requested by the Retry-After header of resp,
+// if any. The header can either be a number of seconds or an HTTP date,
+// which is compared against now.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
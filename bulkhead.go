@@ -0,0 +1,152 @@
+package retryhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBulkheadFull is returned when an attempt cannot be admitted by the
+// bulkhead: either its wait queue is full, or the attempt waited in the
+// queue for longer than the queue timeout.
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// WithBulkhead limits the number of attempts in flight to each host to
+// maxInFlight. Attempts over the limit wait in a queue of up to maxQueue
+// attempts per host for at most queueTimeout, or as long as their context
+// allows if queueTimeout is zero. When the queue is full, attempts are
+// rejected with ErrBulkheadFull.
+//
+// An attempt is in flight from the moment it is sent until its response body
+// is closed. Waiting between attempts does not count.
+func WithBulkhead(maxInFlight, maxQueue int, queueTimeout time.Duration) Option {
+	return func(cfg *config) error {
+		if maxInFlight < 1 {
+			return invalidOption("WithBulkhead", "max in flight must be at least 1, got %d", maxInFlight)
+		}
+		if maxQueue < 0 {
+			return invalidOption("WithBulkhead", "max queue must not be negative, got %d", maxQueue)
+		}
+		if queueTimeout < 0 {
+			return invalidOption("WithBulkhead", "queue timeout must not be negative, got %s", queueTimeout)
+		}
+		cfg.bulkhead = &bulkhead{
+			maxInFlight:  maxInFlight,
+			maxQueue:     maxQueue,
+			queueTimeout: queueTimeout,
+		}
+		return nil
+	}
+}
+
+// BulkheadStats is a snapshot of the bulkhead gauges of a host.
+type BulkheadStats struct {
+	InFlight int
+	Queued   int
+}
+
+// BulkheadStats returns the current bulkhead gauges of every host the
+// client has sent requests to. It returns nil if WithBulkhead is not used.
+func (c *Client) BulkheadStats() map[string]BulkheadStats {
+	bh := c.cfg.Load().bulkhead
+	if bh == nil {
+		return nil
+	}
+
+	stats := make(map[string]BulkheadStats)
+	bh.hosts.Range(func(key, value any) bool {
+		hb := value.(*hostBulkhead)
+		stats[key.(string)] = BulkheadStats{
+			InFlight: len(hb.slots),
+			Queued:   int(hb.queued.Load()),
+		}
+		return true
+	})
+	return stats
+}
+
+// bulkhead holds the per-host compartments.
+type bulkhead struct {
+	maxInFlight  int
+	maxQueue     int
+	queueTimeout time.Duration
+	hosts        sync.Map // map[string]*hostBulkhead
+}
+
+// hostBulkhead is the compartment of a single host. A token in slots is an
+// attempt in flight.
+type hostBulkhead struct {
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+func (bh *bulkhead) host(host string) *hostBulkhead {
+	if hb, ok := bh.hosts.Load(host); ok {
+		return hb.(*hostBulkhead)
+	}
+	hb, _ := bh.hosts.LoadOrStore(host, &hostBulkhead{slots: make(chan struct{}, bh.maxInFlight)})
+	return hb.(*hostBulkhead)
+}
+
+// acquire admits an attempt to host, queueing if needed, and returns the
+// function that releases it.
+func (bh *bulkhead) acquire(ctx context.Context, cfg *config, host string) (func(), error) {
+	hb := bh.host(host)
+	release := func() { <-hb.slots }
+
+	select {
+	case hb.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if hb.queued.Add(1) > int64(bh.maxQueue) {
+		hb.queued.Add(-1)
+		return nil, fmt.Errorf("%w: %s has %d attempts in flight and %d queued", ErrBulkheadFull, host, bh.maxInFlight, bh.maxQueue)
+	}
+	defer hb.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if bh.queueTimeout > 0 {
+		timer := cfg.clock.NewTimer(bh.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+
+	select {
+	case hb.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		return nil, fmt.Errorf("%w: %s did not free up within %s", ErrBulkheadFull, host, bh.queueTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releaseOnClose arranges for release to be called once the body of resp is
+// closed, or right away if there is no body to close.
+func releaseOnClose(resp *http.Response, release func()) {
+	if resp == nil || resp.Body == nil {
+		release()
+		return
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+}
+
+// releasingBody calls release the first time it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (rb *releasingBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.once.Do(rb.release)
+	return err
+}
@@ -0,0 +1,155 @@
+package retryhttp_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+// gatedTransport holds every request until a value is sent on release, then
+// answers it with status.
+type gatedTransport struct {
+	status  int
+	release chan struct{}
+}
+
+func (gt *gatedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-gt.release
+	return &http.Response{
+		StatusCode: gt.status,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// waitForStats polls the bulkhead gauges of host until they match.
+func waitForStats(t *testing.T, client *retryhttp.Client, host string, expected retryhttp.BulkheadStats) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := client.BulkheadStats()[host]
+		if got == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected bulkhead stats %+v, got %+v", expected, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClient_WithBulkhead(t *testing.T) {
+	t.Run("Queue and reject", func(t *testing.T) {
+		gt := &gatedTransport{status: http.StatusOK, release: make(chan struct{})}
+		client := retryhttp.New(
+			retryhttp.WithClient(&http.Client{Transport: gt}),
+			retryhttp.WithBulkhead(1, 1, 0),
+		)
+
+		results := make(chan *http.Response, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				resp, err := client.Get("http://example.com")
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				results <- resp
+			}()
+			waitForStats(t, client, "example.com", retryhttp.BulkheadStats{InFlight: 1, Queued: i})
+		}
+
+		if _, err := client.Get("http://example.com"); !errors.Is(err, retryhttp.ErrBulkheadFull) {
+			t.Fatalf("expected ErrBulkheadFull, got: %v", err)
+		}
+
+		// The first attempt stays in flight until its body is closed.
+		gt.release <- struct{}{}
+		first := <-results
+		waitForStats(t, client, "example.com", retryhttp.BulkheadStats{InFlight: 1, Queued: 1})
+		first.Body.Close()
+
+		gt.release <- struct{}{}
+		second := <-results
+		second.Body.Close()
+		waitForStats(t, client, "example.com", retryhttp.BulkheadStats{InFlight: 0, Queued: 0})
+	})
+
+	t.Run("Queue timeout", func(t *testing.T) {
+		gt := &gatedTransport{status: http.StatusOK, release: make(chan struct{})}
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(&http.Client{Transport: gt}),
+			retryhttp.WithClock(clock),
+			retryhttp.WithBulkhead(1, 5, 3*time.Second),
+		)
+
+		go client.Get("http://example.com")
+		waitForStats(t, client, "example.com", retryhttp.BulkheadStats{InFlight: 1})
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.Get("http://example.com")
+			errc <- err
+		}()
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+		if err := <-errc; !errors.Is(err, retryhttp.ErrBulkheadFull) {
+			t.Fatalf("expected ErrBulkheadFull after the queue timeout, got: %v", err)
+		}
+		close(gt.release)
+	})
+
+	t.Run("Backoff does not count as in flight", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusTooManyRequests},
+			retryhttptest.Step{},
+		)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithBulkhead(1, 0, 0),
+		)
+
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+		clock.BlockUntil(1)
+
+		host := srv.Listener.Addr().String()
+		if got := client.BulkheadStats()[host]; got.InFlight != 0 {
+			t.Fatalf("expected no attempt in flight during backoff, got %+v", got)
+		}
+
+		// With no queue, this would be rejected if the sleeping request
+		// still held the only slot.
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		clock.AdvanceToNext()
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		if _, err := retryhttp.NewE(retryhttp.WithBulkhead(0, -1, -time.Second)); !errors.Is(err, retryhttp.ErrInvalidOption) {
+			t.Fatalf("expected ErrInvalidOption, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package retryhttp
+
+import "time"
+
+// Clock provides the current time and timers to the client. Every wait the
+// client performs goes through its Clock, so tests can replace it with a fake
+// implementation and control the passage of time by hand.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single-shot timer created by a Clock. It mirrors the subset of
+// time.Timer used by the client.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// realClock is the Clock backed by the time package. It is used unless
+// WithClock is provided.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{t: time.NewTimer(d)}
+}
+
+// realTimer adapts a *time.Timer to the Timer interface.
+type realTimer struct {
+	t *time.Timer
+}
+
+func (rt *realTimer) C() <-chan time.Time { return rt.t.C }
+
+func (rt *realTimer) Stop() bool { return rt.t.Stop() }
@@ -0,0 +1,196 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WithClock(t *testing.T) {
+	t.Run("Backoff schedule without real waiting", func(t *testing.T) {
+		var attempts int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer ts.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(ts.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithMaxRetries(4),
+			retryhttp.WithInitialBackoff(time.Second),
+			retryhttp.WithBackoffMultiplier(2),
+			retryhttp.WithMaxBackoff(5*time.Second),
+		)
+
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(ts.URL)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+
+		for i := 0; i < 4; i++ {
+			clock.BlockUntil(1)
+			clock.AdvanceToNext()
+		}
+
+		if err := <-errc; !errors.Is(err, retryhttp.ErrMaxRetriesExceeded) {
+			t.Fatalf("expected ErrMaxRetriesExceeded, got: %v", err)
+		}
+		if attempts != 5 {
+			t.Fatalf("expected 5 attempts, got: %d", attempts)
+		}
+
+		expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected backoff schedule %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Context cancellation during backoff", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer ts.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(ts.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithInitialBackoff(time.Hour),
+			retryhttp.WithMaxBackoff(time.Hour),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.Do(req)
+			errc <- err
+		}()
+
+		clock.BlockUntil(1)
+		cancel()
+
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+		if got := clock.Pending(); got != 0 {
+			t.Fatalf("expected backoff timer to be stopped, got %d pending", got)
+		}
+	})
+
+	t.Run("Retry-After and elapsed time through the clock", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"7"}}},
+			retryhttptest.Step{Status: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"120"}}},
+			retryhttptest.Step{Status: http.StatusTooManyRequests},
+		)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithInitialBackoff(time.Second),
+			retryhttp.WithRetryAfter(30*time.Second),
+			retryhttp.WithMaxElapsedTime(39*time.Second),
+		)
+
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(srv.URL)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+
+		for i := 0; i < 3; i++ {
+			clock.BlockUntil(1)
+			clock.AdvanceToNext()
+		}
+
+		if err := <-errc; !errors.Is(err, retryhttp.ErrMaxElapsedTimeExceeded) {
+			t.Fatalf("expected ErrMaxElapsedTimeExceeded, got: %v", err)
+		}
+		// 7s from Retry-After, 30s capped from Retry-After, then the regular
+		// backoff, which grew to its 2s maximum in the meantime. Another 2s
+		// wait would go past the 39s limit.
+		expected := []time.Duration{7 * time.Second, 30 * time.Second, 2 * time.Second}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+		srv.AssertAttempts(t, 4)
+	})
+
+	t.Run("Linear and constant strategies", func(t *testing.T) {
+		for strategy, expected := range map[retryhttp.BackoffStrategy][]time.Duration{
+			retryhttp.BackoffLinear:   {time.Second, 2 * time.Second, 3 * time.Second},
+			retryhttp.BackoffConstant: {time.Second, time.Second, time.Second},
+		} {
+			srv := retryhttptest.NewServer(retryhttptest.Step{Status: http.StatusTooManyRequests})
+			clock := retryhttptest.NewFakeClock(time.Now())
+			client := retryhttp.New(
+				retryhttp.WithClient(srv.Client()),
+				retryhttp.WithClock(clock),
+				retryhttp.WithMaxRetries(3),
+				retryhttp.WithInitialBackoff(time.Second),
+				retryhttp.WithMaxBackoff(10*time.Second),
+				retryhttp.WithBackoffStrategy(strategy),
+			)
+
+			errc := make(chan error, 1)
+			go func() {
+				_, err := client.Get(srv.URL)
+				errc <- err
+			}()
+			for i := 0; i < 3; i++ {
+				clock.BlockUntil(1)
+				clock.AdvanceToNext()
+			}
+			<-errc
+			srv.Close()
+
+			if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+				t.Fatalf("%s: expected waits %v, got %v", strategy, expected, got)
+			}
+		}
+	})
+
+	t.Run("Non-retryable methods are attempted once", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{Status: http.StatusTooManyRequests})
+		defer srv.Close()
+
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithRetryableMethods(http.MethodGet),
+		)
+		resp, err := client.Post(srv.URL, "text/plain", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected status 429, got %d", resp.StatusCode)
+		}
+		srv.AssertAttempts(t, 1)
+	})
+}
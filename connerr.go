@@ -0,0 +1,147 @@
+package retryhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// ErrOutcomeUnknown is returned, wrapping the original error, when a request
+// with a non-idempotent method failed after it may have reached the server,
+// and UnsafeRetryNotSent prevents retrying it.
+var ErrOutcomeUnknown = errors.New("request outcome unknown")
+
+// UnsafeRetryMode selects when requests with a non-idempotent method, such
+// as POST or PATCH, are retried.
+type UnsafeRetryMode string
+
+const (
+	// UnsafeRetryAlways retries every method the same way. This is the
+	// default.
+	UnsafeRetryAlways UnsafeRetryMode = "always"
+
+	// UnsafeRetryNotSent only retries non-idempotent requests that provably
+	// never reached the server, as reported by IsNotSent.
+	UnsafeRetryNotSent UnsafeRetryMode = "not_sent"
+)
+
+// valid reports whether m is a known mode. The empty mode means
+// UnsafeRetryAlways.
+func (m UnsafeRetryMode) valid() bool {
+	switch m {
+	case "", UnsafeRetryAlways, UnsafeRetryNotSent:
+		return true
+	}
+	return false
+}
+
+// WithUnsafeRetry sets when requests with a non-idempotent method are
+// retried. With UnsafeRetryNotSent, a failed non-idempotent request is only
+// retried if it never reached the server; otherwise, an error failure is
+// returned wrapped in ErrOutcomeUnknown, and a response as it is. Like in
+// net/http, a request is idempotent if its method is GET, HEAD, OPTIONS,
+// TRACE, PUT or DELETE, or if it has an Idempotency-Key or X-Idempotency-Key
+// header.
+func WithUnsafeRetry(mode UnsafeRetryMode) Option {
+	return func(cfg *config) error {
+		if !mode.valid() {
+			return invalidOption("WithUnsafeRetry", "unknown mode %q", mode)
+		}
+		cfg.unsafeRetry = mode
+		return nil
+	}
+}
+
+// IsNotSent reports whether err shows that a request failed before any of it
+// was written to the server, so retrying it is safe whatever its method.
+// This is the case for DNS and dial errors, refused connections, and a
+// reused keep-alive connection that the server had already closed.
+func IsNotSent(err error) bool {
+	if err == nil {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect") {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		strings.Contains(err.Error(), "http: server closed idle connection")
+}
+
+// unsafeRetryAllowed reports whether an attempt of req that failed with err
+// may be retried under the client's unsafe retry mode. If not, it returns
+// the error to give up with.
+func (cfg *config) unsafeRetryAllowed(req *http.Request, err error) (bool, error) {
+	if cfg.unsafeRetry != UnsafeRetryNotSent || idempotent(req) || IsNotSent(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %s %s: %w", ErrOutcomeUnknown, req.Method, req.URL.Redacted(), err)
+	}
+	return false, nil
+}
+
+// idempotent reports whether req can be sent more than once without changing
+// its effect, using the same rules as net/http.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, key := req.Header["Idempotency-Key"]
+	_, xkey := req.Header["X-Idempotency-Key"]
+	return key || xkey
+}
+
+// connectionErrorMessages are found in errors of net/http that break a
+// connection but are not exported as values, such as those of its bundled
+// HTTP/2 implementation.
+var connectionErrorMessages = []string{
+	"http: server closed idle connection",
+	"transport connection broken",
+	"server sent GOAWAY",
+	"http2: client connection lost",
+	"http2: client connection force closed",
+}
+
+// IsConnectionError reports whether err is a connection-level failure, such
+// as a connection reset or closed by the server, an unexpected EOF or an
+// HTTP/2 GOAWAY, as opposed to an application-level one. After a
+// connection-level failure, other idle connections to the same server are
+// likely dead too, so the client closes them before the next attempt. Those
+// of http.DefaultTransport, which other code shares, are left alone, and the
+// next attempt opens a new connection instead.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range []error{
+		io.EOF,
+		io.ErrUnexpectedEOF,
+		net.ErrClosed,
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.ECONNREFUSED,
+		syscall.EPIPE,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	msg := err.Error()
+	for _, m := range connectionErrorMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
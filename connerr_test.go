@@ -0,0 +1,227 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Nil", nil, false},
+		{"Connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"EOF", fmt.Errorf("Post %q: %w", "http://example.com", io.EOF), true},
+		{"GOAWAY", errors.New("http2: server sent GOAWAY and closed the connection; LastStreamID=1"), true},
+		{"Context canceled", context.Canceled, false},
+		{"Application error", errors.New("unexpected status"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryhttp.IsConnectionError(tt.err); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsNotSent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Nil", nil, false},
+		{"Dial error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, true},
+		{"DNS error", &url.Error{Op: "Post", URL: "http://example.invalid", Err: &net.DNSError{Err: "no such host", Name: "example.invalid"}}, true},
+		{"Server closed idle connection", errors.New("http: server closed idle connection"), true},
+		{"Connection reset while reading", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, false},
+		{"EOF", io.EOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryhttp.IsNotSent(tt.err); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClient_WithUnsafeRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		header   http.Header
+		faults   []retryhttptest.Fault
+		attempts int
+		unknown  bool
+	}{
+		{"POST never sent is retried", http.MethodPost, nil, []retryhttptest.Fault{retryhttptest.ConnRefused()}, 2, false},
+		{"POST possibly sent is not retried", http.MethodPost, nil, []retryhttptest.Fault{retryhttptest.ConnReset()}, 1, true},
+		{"POST with an idempotency key is retried", http.MethodPost, http.Header{"Idempotency-Key": {"abc"}}, []retryhttptest.Fault{retryhttptest.ConnReset()}, 2, false},
+		{"PUT is retried", http.MethodPut, nil, []retryhttptest.Fault{retryhttptest.ConnReset()}, 2, false},
+		{"POST answered by the server is returned", http.MethodPost, nil, []retryhttptest.Fault{retryhttptest.Status(http.StatusServiceUnavailable, 0)}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := retryhttptest.NewServer()
+			defer srv.Close()
+			ft := retryhttptest.NewFaultTransport(srv.Client().Transport, 1)
+			ft.Schedule(tt.faults...)
+
+			client := retryhttp.New(
+				retryhttp.WithClient(&http.Client{Transport: ft}),
+				retryhttp.WithCondition(func(resp *http.Response, err error) bool {
+					return err != nil || resp.StatusCode >= 500
+				}),
+				retryhttp.WithInitialBackoff(0),
+				retryhttp.WithUnsafeRetry(retryhttp.UnsafeRetryNotSent),
+			)
+
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("payload"))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := client.Do(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if got := len(ft.Injected()); got != tt.attempts {
+				t.Fatalf("expected %d attempts, got %d", tt.attempts, got)
+			}
+			if tt.unknown {
+				if !errors.Is(err, retryhttp.ErrOutcomeUnknown) || !errors.Is(err, syscall.ECONNRESET) {
+					t.Fatalf("expected ErrOutcomeUnknown wrapping the reset, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+type connGeneration struct{}
+
+func TestClient_Do_StaleConnections(t *testing.T) {
+	t.Run("own transport", func(t *testing.T) {
+		client := retryhttp.New(
+			retryhttp.WithClient(&http.Client{Transport: &http.Transport{}}),
+			retryhttp.WithMaxRetries(1),
+			retryhttp.WithInitialBackoff(0),
+		)
+		defer client.CloseIdleConnections()
+		testStaleConnections(t, client)
+	})
+
+	t.Run("default transport", func(t *testing.T) {
+		// The idle connections of http.DefaultTransport are left alone, but
+		// the retry does not pick one of them.
+		testStaleConnections(t, retryhttp.New(retryhttp.WithMaxRetries(1), retryhttp.WithInitialBackoff(0)))
+	})
+}
+
+func testStaleConnections(t *testing.T, client *retryhttp.Client) {
+	t.Helper()
+
+	// The server tags each connection with the generation it was opened in.
+	// Bumping the generation simulates a restart: requests on older
+	// connections are read, then the connection is dropped without an answer.
+	var generation atomic.Int32
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.Context().Value(connGeneration{}).(int32) < generation.Load() {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		if r.URL.Path == "/warmup" {
+			arrived.Done()
+			arrived.Wait()
+		}
+	}))
+	srv.Config.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+		return context.WithValue(ctx, connGeneration{}, generation.Load())
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// Fill the pool with two idle connections.
+	var warmup sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		warmup.Add(1)
+		go func() {
+			defer warmup.Done()
+			resp, err := client.Get(srv.URL + "/warmup")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	warmup.Wait()
+
+	generation.Add(1)
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("expected a single retry on a fresh connection to succeed, got: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClient_Do_StaleConnections_DefaultTransport(t *testing.T) {
+	// An idle connection to another server, in the pool of the shared
+	// http.DefaultTransport.
+	other := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer other.Close()
+	resp, err := http.Get(other.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+
+	client := retryhttp.New(retryhttp.WithMaxRetries(1), retryhttp.WithInitialBackoff(0))
+	if _, err := client.Get(broken.URL); !retryhttp.IsConnectionError(err) {
+		t.Fatalf("expected a connection error, got: %v", err)
+	}
+
+	var reused bool
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, other.URL, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	resp.Body.Close()
+	if !reused {
+		t.Fatal("expected the idle connections of http.DefaultTransport to be left alone")
+	}
+}
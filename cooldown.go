@@ -0,0 +1,103 @@
+package retryhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrHostCoolingDown is returned, in CooldownFailFast mode, for attempts to a
+// host that recently pushed back.
+var ErrHostCoolingDown = errors.New("host is cooling down")
+
+// CooldownMode selects what happens to attempts made to a host that is
+// cooling down.
+type CooldownMode int
+
+const (
+	// CooldownWait holds attempts back until the cooldown is over.
+	CooldownWait CooldownMode = iota
+
+	// CooldownFailFast fails attempts right away with ErrHostCoolingDown.
+	// The request that got the pushback is not retried: its response is
+	// returned instead.
+	CooldownFailFast
+)
+
+// WithHostCooldown makes pushback from a host apply to every request the
+// client sends to it. When a host answers with 429 or 503 and a Retry-After
+// header, all attempts to that host, from any goroutine, are paused until
+// the requested time has passed, instead of each caller finding out on its
+// own. Paused attempts either wait or fail fast, depending on mode.
+func WithHostCooldown(mode CooldownMode) Option {
+	return func(cfg *config) error {
+		if mode != CooldownWait && mode != CooldownFailFast {
+			return invalidOption("WithHostCooldown", "unknown mode %d", mode)
+		}
+		cfg.cooldown = &cooldownRegistry{mode: mode, until: make(map[string]time.Time)}
+		return nil
+	}
+}
+
+// cooldownRegistry keeps the time until which each host is cooling down.
+type cooldownRegistry struct {
+	mode CooldownMode
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// wait returns once host is not cooling down, or fails right away in
+// CooldownFailFast mode.
+func (cr *cooldownRegistry) wait(ctx context.Context, cfg *config, host string) error {
+	for {
+		d := cr.remaining(host, cfg.clock.Now())
+		if d <= 0 {
+			return nil
+		}
+		if cr.mode == CooldownFailFast {
+			return fmt.Errorf("%w: %s for another %s", ErrHostCoolingDown, host, d)
+		}
+		if err := cfg.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// remaining returns how long host still has to cool down.
+func (cr *cooldownRegistry) remaining(host string, now time.Time) time.Duration {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	until, ok := cr.until[host]
+	if !ok {
+		return 0
+	}
+	if !now.Before(until) {
+		delete(cr.until, host)
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// observe starts or extends the cooldown of host if resp is a pushback, and
+// reports whether it was one.
+func (cr *cooldownRegistry) observe(host string, resp *http.Response, now time.Time) bool {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return false
+	}
+	d, ok := retryAfter(resp, now)
+	if !ok || d <= 0 {
+		return false
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if until := now.Add(d); until.After(cr.until[host]) {
+		cr.until[host] = until
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package retryhttp_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WithHostCooldown(t *testing.T) {
+	pushback := retryhttptest.Step{
+		Status: http.StatusServiceUnavailable,
+		Header: http.Header{"Retry-After": {"30"}},
+	}
+
+	t.Run("Other callers wait for the cooldown", func(t *testing.T) {
+		srv := retryhttptest.NewServer(pushback, retryhttptest.Step{})
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithMaxRetries(0),
+			retryhttp.WithHostCooldown(retryhttp.CooldownWait),
+		)
+
+		resp, err := client.Get(srv.URL + "/first")
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, retryhttp.ErrMaxRetriesExceeded) {
+			t.Fatalf("expected the first caller to give up, got: %v", err)
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(srv.URL + "/second")
+			if err == nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+		clock.BlockUntil(1)
+		srv.AssertAttempts(t, 1)
+		clock.AdvanceToNext()
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error after the cooldown, got: %v", err)
+		}
+
+		expected := []time.Duration{30 * time.Second}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Fail fast returns the pushback to its request", func(t *testing.T) {
+		srv := retryhttptest.NewServer(pushback, retryhttptest.Step{})
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithMaxRetries(3),
+			retryhttp.WithHostCooldown(retryhttp.CooldownFailFast),
+		)
+
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected the pushback response, got: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected status 503, got %d", resp.StatusCode)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Fatal("expected the Retry-After header of the pushback")
+		}
+		srv.AssertAttempts(t, 1)
+		if got := clock.Durations(); len(got) != 0 {
+			t.Fatalf("expected no waits, got %v", got)
+		}
+	})
+
+	t.Run("Fail fast while cooling down", func(t *testing.T) {
+		srv := retryhttptest.NewServer(pushback, retryhttptest.Step{})
+		defer srv.Close()
+		other := retryhttptest.NewServer()
+		defer other.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithMaxRetries(0),
+			retryhttp.WithHostCooldown(retryhttp.CooldownFailFast),
+		)
+
+		resp, _ := client.Get(srv.URL)
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if _, err := client.Get(srv.URL); !errors.Is(err, retryhttp.ErrHostCoolingDown) {
+			t.Fatalf("expected ErrHostCoolingDown, got: %v", err)
+		}
+		srv.AssertAttempts(t, 1)
+
+		resp, err := client.Get(other.URL)
+		if err != nil {
+			t.Fatalf("expected other hosts to be unaffected, got: %v", err)
+		}
+		resp.Body.Close()
+
+		clock.Advance(30 * time.Second)
+		resp, err = client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error after the cooldown, got: %v", err)
+		}
+		resp.Body.Close()
+		srv.AssertAttempts(t, 2)
+	})
+}
@@ -0,0 +1,254 @@
+package retryhttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"iter"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a single server-sent event.
+type Event struct {
+	// ID is the last event ID seen on the stream when the event was
+	// dispatched. It is sent back to the server in the Last-Event-ID header
+	// when reconnecting.
+	ID string
+
+	// Type is the event type, "message" unless the server set another one.
+	Type string
+
+	// Data is the payload, with multiple data lines joined by newlines.
+	Data string
+}
+
+// EventSource reads a stream of server-sent events, as described by the
+// text/event-stream format of the HTML standard, and reconnects when the
+// stream ends. Set its fields before calling Events.
+type EventSource struct {
+	// Header holds extra headers sent with every connection request.
+	Header http.Header
+
+	// LastEventID is sent in the Last-Event-ID header when connecting. It
+	// starts empty unless set, and is updated as events are received.
+	LastEventID string
+
+	// HealthyAfter is how long a connection has to stay up for the
+	// reconnection backoff to start over. The default is 30 seconds.
+	HealthyAfter time.Duration
+
+	client   *Client
+	url      string
+	retry    time.Duration
+	hasRetry bool
+}
+
+// NewEventSource returns an EventSource that reads events from url with c.
+// Each connection is made with c.Do, so it is retried like any other request.
+func (c *Client) NewEventSource(url string) *EventSource {
+	return &EventSource{
+		HealthyAfter: 30 * time.Second,
+		client:       c,
+		url:          url,
+	}
+}
+
+// Events connects to the stream and yields its events as they arrive. When
+// the stream ends or the connection breaks, it waits and reconnects, sending
+// the last event ID. The wait is the reconnection time set by the server
+// with the "retry" field, or else the backoff of the client, which starts
+// over once a connection has stayed up for HealthyAfter.
+//
+// When a connection cannot be made at all, such as when the server is down,
+// the error is yielded and Events reconnects as usual, unless the caller
+// stops the iteration. The iteration ends without an error when the server
+// answers 204 No Content. It ends by yielding an error when ctx is done, or
+// when the server answers with another status than 200 OK, or with another
+// content type than text/event-stream.
+func (es *EventSource) Events(ctx context.Context) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		cfg := es.client.cfg.Load()
+		backoff := cfg.initialBackoff
+
+		for {
+			connected, done, err := es.stream(ctx, yield)
+			if done {
+				if err != nil {
+					yield(Event{}, err)
+				}
+				return
+			}
+
+			if !connected.IsZero() && cfg.clock.Now().Sub(connected) >= es.HealthyAfter {
+				backoff = cfg.initialBackoff
+			}
+			wait := backoff
+			if es.hasRetry {
+				wait = es.retry
+			}
+			backoff = cfg.nextBackoff(backoff)
+
+			if err := cfg.sleep(ctx, wait); err != nil {
+				yield(Event{}, err)
+				return
+			}
+		}
+	}
+}
+
+// stream makes a single connection and yields its events. It returns when
+// the connection ends, with the time it was established, if it was. done is
+// true if the iteration must stop, with err as its outcome.
+func (es *EventSource) stream(ctx context.Context, yield func(Event, error) bool) (connected time.Time, done bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, es.url, nil)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	for key, values := range es.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if es.LastEventID != "" {
+		req.Header.Set("Last-Event-ID", es.LastEventID)
+	}
+
+	resp, err := es.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return time.Time{}, true, ctx.Err()
+		}
+		if !yield(Event{}, fmt.Errorf("event source: %w", err)) {
+			return time.Time{}, true, nil
+		}
+		return time.Time{}, false, nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return time.Time{}, true, nil
+	case resp.StatusCode != http.StatusOK:
+		return time.Time{}, true, fmt.Errorf("event source: unexpected status %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return time.Time{}, true, fmt.Errorf("event source: unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	connected = es.client.cfg.Load().clock.Now()
+	er := &eventReader{r: bufio.NewReader(resp.Body), id: es.LastEventID}
+	for {
+		ev, ok, err := er.next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return connected, true, ctx.Err()
+			}
+			return connected, false, nil
+		}
+		es.LastEventID = er.id
+		if er.hasRetry {
+			es.retry, es.hasRetry = er.retry, true
+		}
+		if ok && !yield(ev, nil) {
+			return connected, true, nil
+		}
+	}
+}
+
+// eventReader parses the text/event-stream format.
+type eventReader struct {
+	r      *bufio.Reader
+	skipLF bool
+	lines  int
+
+	id       string
+	retry    time.Duration
+	hasRetry bool
+}
+
+// next reads up to the end of the next event. ok is false if the event had
+// no data, in which case only the event ID and the reconnection time may
+// have changed.
+func (er *eventReader) next() (ev Event, ok bool, err error) {
+	var data strings.Builder
+	for {
+		line, err := er.readLine()
+		if err != nil {
+			// An event cut off by the end of the stream is discarded.
+			return Event{}, false, err
+		}
+
+		if line == "" {
+			if data.Len() == 0 {
+				return Event{}, false, nil
+			}
+			if ev.Type == "" {
+				ev.Type = "message"
+			}
+			ev.ID = er.id
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			return ev, true, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Type = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.id = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				er.retry = time.Duration(ms) * time.Millisecond
+				er.hasRetry = true
+			}
+		}
+	}
+}
+
+// readLine reads a line ended by CRLF, LF or CR, without its end.
+func (er *eventReader) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := er.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if er.skipLF {
+			er.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\n':
+			return er.finish(line), nil
+		case '\r':
+			er.skipLF = true
+			return er.finish(line), nil
+		}
+		line = append(line, b)
+	}
+}
+
+// finish returns line as a string, without the byte order mark the stream
+// may start with.
+func (er *eventReader) finish(line []byte) string {
+	er.lines++
+	if er.lines == 1 {
+		return strings.TrimPrefix(string(line), "\uFEFF")
+	}
+	return string(line)
+}
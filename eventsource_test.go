@@ -0,0 +1,220 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+// eventStream answers each connection with the next of conns, writing an
+// event stream, or with a 204 No Content once conns run out.
+func eventStream(t *testing.T, conns ...func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	t.Helper()
+	var n atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(n.Add(1)) - 1
+		if i >= len(conns) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		conns[i](w, r)
+	}))
+}
+
+func TestEventSource(t *testing.T) {
+	t.Run("Parses events and resumes from the last ID", func(t *testing.T) {
+		var lastEventID string
+		srv := eventStream(t,
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "\uFEFF: comment\n"+
+					"retry: 1\n"+
+					"id: 1\nevent: greeting\ndata: hello\ndata:  world\n\n"+
+					"data: same id\r\n\r\n"+
+					"id: 2\rdata:x\r\r"+
+					"data: cut off")
+			},
+			func(w http.ResponseWriter, r *http.Request) {
+				lastEventID = r.Header.Get("Last-Event-ID")
+				io.WriteString(w, "data: resumed\n\n")
+			},
+		)
+		defer srv.Close()
+
+		es := retryhttp.New().NewEventSource(srv.URL)
+		var events []retryhttp.Event
+		for ev, err := range es.Events(context.Background()) {
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			events = append(events, ev)
+		}
+
+		expected := []retryhttp.Event{
+			{ID: "1", Type: "greeting", Data: "hello\n world"},
+			{ID: "1", Type: "message", Data: "same id"},
+			{ID: "2", Type: "message", Data: "x"},
+			{ID: "2", Type: "message", Data: "resumed"},
+		}
+		if !reflect.DeepEqual(events, expected) {
+			t.Fatalf("expected events %+v, got %+v", expected, events)
+		}
+		if lastEventID != "2" {
+			t.Fatalf("expected Last-Event-ID 2 on reconnect, got %q", lastEventID)
+		}
+	})
+
+	t.Run("Reconnects with backoff", func(t *testing.T) {
+		hangUp := func(http.ResponseWriter, *http.Request) {}
+		release := make(chan struct{})
+		srv := eventStream(t,
+			hangUp,
+			hangUp,
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "data: healthy\n\n")
+				w.(http.Flusher).Flush()
+				<-release
+			},
+			hangUp,
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "retry: 7000\n\n")
+			},
+		)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(retryhttp.WithClock(clock), retryhttp.WithMaxBackoff(time.Minute))
+		es := client.NewEventSource(srv.URL)
+		es.HealthyAfter = time.Minute
+
+		events := make(chan retryhttp.Event)
+		errc := make(chan error, 1)
+		go func() {
+			for ev, err := range es.Events(context.Background()) {
+				if err != nil {
+					errc <- err
+					return
+				}
+				events <- ev
+			}
+			close(events)
+		}()
+
+		// Two failed connections in a row back off further each time.
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+
+		// A connection that stays up long enough resets the backoff.
+		if ev := <-events; ev.Data != "healthy" {
+			t.Fatalf("expected the healthy event, got %+v", ev)
+		}
+		clock.Advance(time.Minute)
+		close(release)
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+
+		// The next failure backs off again, then the server asks for 7s.
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+
+		if _, ok := <-events; ok {
+			t.Fatal("expected the stream to end on 204 No Content")
+		}
+		expected := []time.Duration{
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			7 * time.Second,
+		}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Yields connection errors and keeps reconnecting", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		url := srv.URL
+		srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(retryhttp.WithClock(clock), retryhttp.WithMaxRetries(0))
+
+		errc := make(chan error)
+		go func() {
+			defer close(errc)
+			failures := 0
+			for _, err := range client.NewEventSource(url).Events(context.Background()) {
+				errc <- err
+				if failures++; failures == 2 {
+					return
+				}
+			}
+		}()
+
+		if err := <-errc; err == nil || !retryhttp.IsNotSent(err) {
+			t.Fatalf("expected the connection error, got: %v", err)
+		}
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+		if err := <-errc; err == nil {
+			t.Fatal("expected a second connection error after reconnecting")
+		}
+		if _, ok := <-errc; ok {
+			t.Fatal("expected the iteration to stop when the caller stops")
+		}
+	})
+
+	t.Run("Fails on other statuses", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		for _, err := range retryhttp.New().NewEventSource(srv.URL).Events(context.Background()) {
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		}
+	})
+
+	t.Run("Stops when the context is done", func(t *testing.T) {
+		srv := eventStream(t, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "data: one\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		})
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var got error
+		for ev, err := range retryhttp.New().NewEventSource(srv.URL).Events(ctx) {
+			if err != nil {
+				got = err
+				break
+			}
+			if ev.Data == "one" {
+				cancel()
+			}
+		}
+		if !errors.Is(got, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", got)
+		}
+	})
+}
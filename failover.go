@@ -0,0 +1,259 @@
+package retryhttp
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Endpoint is a base URL a request can be sent to. Only its scheme and host
+// are used: they replace those of the request URL.
+type Endpoint struct {
+	URL string
+
+	// Weight makes the first attempt of each request pick an endpoint at
+	// random, in proportion to the weights. If every weight is zero, the
+	// endpoints are tried in the order they were given instead.
+	Weight int
+}
+
+// AttemptInfo describes a single attempt made by the client.
+type AttemptInfo struct {
+	// Attempt is the number of the attempt, starting at zero.
+	Attempt int
+
+	// Endpoint is the scheme and host the attempt was sent to, such as
+	// "https://eu.example.com".
+	Endpoint string
+
+	// Address is the IP address and port dialed for the attempt, if the
+	// client rotates addresses with WithAddressRotation.
+	Address string
+
+	// StatusCode is the status of the response, or zero if there was none.
+	StatusCode int
+
+	// Err is the error returned by the attempt, if any.
+	Err error
+}
+
+// WithOnAttempt calls fn after every attempt, retries included.
+func WithOnAttempt(fn func(AttemptInfo)) Option {
+	return func(cfg *config) error {
+		if fn == nil {
+			return invalidOption("WithOnAttempt", "function must not be nil")
+		}
+		cfg.onAttempt = fn
+		return nil
+	}
+}
+
+// WithEndpoints spreads requests over several equivalent endpoints, such as
+// the same service in different regions. Every attempt rewrites the scheme
+// and host of the request to one of the endpoints, and each retry moves on to
+// the next healthy endpoint instead of hitting the same one again.
+//
+// Endpoint health is tracked passively: an endpoint that fails, with a
+// network error or a 5xx response, is skipped for a while. See
+// WithEndpointHealth to tune this, and Client.ProbeEndpoints to also check
+// endpoints actively. If no endpoint is healthy, all of them are used.
+func WithEndpoints(endpoints ...Endpoint) Option {
+	return func(cfg *config) error {
+		if len(endpoints) == 0 {
+			return invalidOption("WithEndpoints", "at least one endpoint is required")
+		}
+
+		fo := &failover{}
+		for _, e := range endpoints {
+			u, err := url.Parse(e.URL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return invalidOption("WithEndpoints", "%q is not an absolute URL", e.URL)
+			}
+			if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+				return invalidOption("WithEndpoints", "%q must not have a path or query, only a scheme and host", e.URL)
+			}
+			if e.Weight < 0 {
+				return invalidOption("WithEndpoints", "weight of %q must not be negative, got %d", e.URL, e.Weight)
+			}
+			fo.weighted = fo.weighted || e.Weight > 0
+			fo.endpoints = append(fo.endpoints, &endpointState{scheme: u.Scheme, host: u.Host, weight: e.Weight})
+		}
+		cfg.failover = fo
+		return nil
+	}
+}
+
+// WithEndpointHealth sets how many consecutive failures take an endpoint out
+// of rotation, and for how long. The default is one failure and 30 seconds.
+func WithEndpointHealth(failures int, cooldown time.Duration) Option {
+	return func(cfg *config) error {
+		if failures < 1 {
+			return invalidOption("WithEndpointHealth", "failures must be at least 1, got %d", failures)
+		}
+		if cooldown < 0 {
+			return invalidOption("WithEndpointHealth", "cooldown must not be negative, got %s", cooldown)
+		}
+		cfg.endpointFailures = failures
+		cfg.endpointCooldown = cooldown
+		return nil
+	}
+}
+
+// ProbeEndpoints actively checks the health of the endpoints set with
+// WithEndpoints, until ctx is done. Every interval, it sends a GET request
+// for path to each endpoint, without retries: a 2xx response brings the
+// endpoint back into rotation, anything else takes it out until the next
+// probe, or longer if the endpoint cooldown is longer than interval. It is
+// meant to be run in its own goroutine, and returns the context error, or an
+// error right away if interval is not positive.
+func (c *Client) ProbeEndpoints(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("retryhttp: ProbeEndpoints: interval must be positive, got %s", interval)
+	}
+	for {
+		cfg := c.cfg.Load()
+		if cfg.failover != nil {
+			for _, ep := range cfg.failover.endpoints {
+				cfg.failover.probe(ctx, cfg, ep, path, interval)
+			}
+		}
+		if err := cfg.sleep(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+// failover holds the endpoints and their health.
+type failover struct {
+	endpoints []*endpointState
+	weighted  bool
+
+	mu sync.Mutex
+}
+
+// endpointState is an endpoint and its health.
+type endpointState struct {
+	scheme, host string
+	weight       int
+
+	failures  int
+	downUntil time.Time
+}
+
+func (ep *endpointState) String() string {
+	return ep.scheme + "://" + ep.host
+}
+
+// pick returns the endpoint for an attempt: for the first attempt, the first
+// healthy one, or a weighted random one; for retries, the next healthy one
+// after previous.
+func (fo *failover) pick(previous *endpointState, now time.Time) *endpointState {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	healthy := make([]*endpointState, 0, len(fo.endpoints))
+	for _, ep := range fo.endpoints {
+		if !now.Before(ep.downUntil) {
+			healthy = append(healthy, ep)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = fo.endpoints
+	}
+
+	if previous != nil {
+		// Move on to the first healthy endpoint after the previous one.
+		start := 0
+		for i, ep := range fo.endpoints {
+			if ep == previous {
+				start = i + 1
+				break
+			}
+		}
+		for i := range fo.endpoints {
+			ep := fo.endpoints[(start+i)%len(fo.endpoints)]
+			for _, h := range healthy {
+				if h == ep {
+					return ep
+				}
+			}
+		}
+	}
+
+	if fo.weighted {
+		var total int
+		for _, ep := range healthy {
+			total += ep.weight
+		}
+		if total > 0 {
+			n := rand.IntN(total)
+			for _, ep := range healthy {
+				if n < ep.weight {
+					return ep
+				}
+				n -= ep.weight
+			}
+		}
+	}
+	return healthy[0]
+}
+
+// observe updates the health of ep from the outcome of an attempt.
+func (fo *failover) observe(cfg *config, ep *endpointState, resp *http.Response, err error) {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	if err == nil && resp != nil && resp.StatusCode < 500 {
+		ep.failures = 0
+		ep.downUntil = time.Time{}
+		return
+	}
+	ep.failures++
+	if ep.failures >= cfg.endpointFailures {
+		ep.downUntil = cfg.clock.Now().Add(cfg.endpointCooldown)
+	}
+}
+
+// probe checks a single endpoint, which is probed again after interval.
+func (fo *failover) probe(ctx context.Context, cfg *config, ep *endpointState, path string, interval time.Duration) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.String()+path, nil)
+	if err != nil {
+		return
+	}
+	resp, err := cfg.client.Do(req)
+	if ctx.Err() != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
+	}
+	healthy := err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	if healthy {
+		ep.failures = 0
+		ep.downUntil = time.Time{}
+	} else {
+		// Keep the endpoint out of rotation until the next probe says
+		// otherwise.
+		ep.failures = max(ep.failures, cfg.endpointFailures)
+		ep.downUntil = cfg.clock.Now().Add(max(cfg.endpointCooldown, interval))
+	}
+}
+
+// rewrite returns a copy of req sent to ep.
+func (ep *endpointState) rewrite(req *http.Request) *http.Request {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = ep.scheme
+	out.URL.Host = ep.host
+	out.Host = ""
+	return out
+}
@@ -0,0 +1,212 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WithEndpoints(t *testing.T) {
+	t.Run("Retries move on to the next endpoint", func(t *testing.T) {
+		primary := retryhttptest.NewServer(retryhttptest.Repeat(3, retryhttptest.Step{Status: http.StatusServiceUnavailable})...)
+		defer primary.Close()
+		secondary := retryhttptest.NewServer()
+		defer secondary.Close()
+
+		var served []string
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithMaxRetries(1),
+			retryhttp.WithInitialBackoff(0),
+			retryhttp.WithEndpoints(
+				retryhttp.Endpoint{URL: primary.URL},
+				retryhttp.Endpoint{URL: secondary.URL},
+			),
+			retryhttp.WithEndpointHealth(1, time.Minute),
+			retryhttp.WithOnAttempt(func(info retryhttp.AttemptInfo) {
+				served = append(served, info.Endpoint)
+			}),
+		)
+
+		get := func() {
+			t.Helper()
+			resp, err := client.Get("http://api.invalid/items?page=2")
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", resp.StatusCode)
+			}
+		}
+
+		get()
+		if expected := []string{primary.URL, secondary.URL}; !reflect.DeepEqual(served, expected) {
+			t.Fatalf("expected attempts on %v, got %v", expected, served)
+		}
+		if got := secondary.Requests()[0]; got.Path != "/items" || got.Query != "page=2" {
+			t.Fatalf("expected the path and query to be kept, got %q and %q", got.Path, got.Query)
+		}
+
+		// The primary failed, so it is skipped until its cooldown is over.
+		served = nil
+		get()
+		if expected := []string{secondary.URL}; !reflect.DeepEqual(served, expected) {
+			t.Fatalf("expected attempts on %v, got %v", expected, served)
+		}
+
+		clock.Advance(time.Minute)
+		served = nil
+		resp, _ := client.Get("http://api.invalid/items")
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if len(served) == 0 || served[0] != primary.URL {
+			t.Fatalf("expected the primary to be back in rotation, got attempts on %v", served)
+		}
+		primary.AssertAttempts(t, 2)
+	})
+
+	t.Run("Weights pick the first endpoint", func(t *testing.T) {
+		unused := retryhttptest.NewServer()
+		defer unused.Close()
+		preferred := retryhttptest.NewServer()
+		defer preferred.Close()
+
+		client := retryhttp.New(retryhttp.WithEndpoints(
+			retryhttp.Endpoint{URL: unused.URL, Weight: 0},
+			retryhttp.Endpoint{URL: preferred.URL, Weight: 1},
+		))
+		for i := 0; i < 5; i++ {
+			resp, err := client.Get("http://api.invalid/")
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			resp.Body.Close()
+		}
+		unused.AssertAttempts(t, 0)
+		preferred.AssertAttempts(t, 5)
+	})
+
+	t.Run("Probes take endpoints in and out of rotation", func(t *testing.T) {
+		primary := retryhttptest.NewServer()
+		defer primary.Close()
+		primary.Handle("/healthz", retryhttptest.Step{Status: http.StatusServiceUnavailable}, retryhttptest.Step{})
+		secondary := retryhttptest.NewServer()
+		defer secondary.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithEndpoints(
+				retryhttp.Endpoint{URL: primary.URL},
+				retryhttp.Endpoint{URL: secondary.URL},
+			),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- client.ProbeEndpoints(ctx, "/healthz", 10*time.Second) }()
+
+		get := func() *http.Request {
+			t.Helper()
+			resp, err := client.Get("http://api.invalid/")
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			resp.Body.Close()
+			return resp.Request
+		}
+
+		clock.BlockUntil(1)
+		if got := get().URL.Host; got != secondary.Listener.Addr().String() {
+			t.Fatalf("expected the failed probe to skip the primary, got %s", got)
+		}
+
+		clock.AdvanceToNext()
+		clock.BlockUntil(1)
+		if got := get().URL.Host; got != primary.Listener.Addr().String() {
+			t.Fatalf("expected the healthy probe to restore the primary, got %s", got)
+		}
+
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+	})
+
+	t.Run("Probed endpoints stay out until the next probe", func(t *testing.T) {
+		primary := retryhttptest.NewServer()
+		defer primary.Close()
+		primary.Handle("/healthz", retryhttptest.Step{Status: http.StatusServiceUnavailable})
+		secondary := retryhttptest.NewServer()
+		defer secondary.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithEndpoints(
+				retryhttp.Endpoint{URL: primary.URL},
+				retryhttp.Endpoint{URL: secondary.URL},
+			),
+			retryhttp.WithEndpointHealth(1, time.Second),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- client.ProbeEndpoints(ctx, "/healthz", 10*time.Second) }()
+		clock.BlockUntil(1)
+
+		// The endpoint cooldown is over, but the next probe is not due yet.
+		clock.Advance(5 * time.Second)
+		resp, err := client.Get("http://api.invalid/")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		if got := resp.Request.URL.Host; got != secondary.Listener.Addr().String() {
+			t.Fatalf("expected the primary to stay out of rotation, got %s", got)
+		}
+
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+	})
+
+	t.Run("Probe interval must be positive", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		client := retryhttp.New(retryhttp.WithEndpoints(retryhttp.Endpoint{URL: srv.URL}))
+		for _, interval := range []time.Duration{0, -time.Second} {
+			if err := client.ProbeEndpoints(context.Background(), "/healthz", interval); err == nil {
+				t.Fatalf("expected an error for interval %s", interval)
+			}
+		}
+		srv.AssertAttempts(t, 0)
+	})
+
+	t.Run("Invalid endpoints", func(t *testing.T) {
+		for _, opt := range []retryhttp.Option{
+			retryhttp.WithEndpoints(),
+			retryhttp.WithEndpoints(retryhttp.Endpoint{URL: "example.com"}),
+			retryhttp.WithEndpoints(retryhttp.Endpoint{URL: "https://example.com/v1"}),
+			retryhttp.WithEndpoints(retryhttp.Endpoint{URL: "https://example.com", Weight: -1}),
+			retryhttp.WithEndpointHealth(0, time.Second),
+			retryhttp.WithOnAttempt(nil),
+		} {
+			if _, err := retryhttp.NewE(opt); !errors.Is(err, retryhttp.ErrInvalidOption) {
+				t.Fatalf("expected ErrInvalidOption, got: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package retryhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrResponseTooLarge is returned by the JSON helpers when a response body
+// is larger than the maximum response size.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// httpErrorSnippetSize is how much of the body an HTTPError keeps.
+const httpErrorSnippetSize = 4 << 10
+
+// HTTPError is returned by the JSON helpers when the final response has a
+// status outside of the 2xx range.
+type HTTPError struct {
+	// StatusCode and Status are those of the response, such as 404 and
+	// "404 Not Found".
+	StatusCode int
+	Status     string
+
+	// Header holds the response headers.
+	Header http.Header
+
+	// Body holds the start of the response body, up to 4 KiB, including when
+	// the request ran out of retries.
+	Body []byte
+
+	err error
+}
+
+func (e *HTTPError) Error() string {
+	msg := "unexpected status " + e.Status
+	if snippet := strings.TrimSpace(string(e.Body)); snippet != "" {
+		msg += ": " + snippet
+	}
+	if e.err != nil {
+		msg += ": " + e.err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the error that ended the retries, such as
+// ErrMaxRetriesExceeded, if any.
+func (e *HTTPError) Unwrap() error {
+	return e.err
+}
+
+// JSONOption configures a single call to one of the JSON helpers.
+type JSONOption func(*jsonConfig)
+
+// jsonConfig holds the settings of a call to a JSON helper.
+type jsonConfig struct {
+	maxSize        int64
+	retryTruncated bool
+	err            error
+}
+
+// MaxResponseSize caps the size of the response body that is read. The
+// default is 10 MiB.
+func MaxResponseSize(n int64) JSONOption {
+	return func(jc *jsonConfig) {
+		if n <= 0 {
+			jc.err = invalidOption("MaxResponseSize", "size must be positive, got %d", n)
+			return
+		}
+		jc.maxSize = n
+	}
+}
+
+// RetryTruncatedBody sends the request again when the response body
+// ends before the JSON document does, as happens when a connection breaks
+// in the middle of a response. Such retries follow the retryable methods and
+// the unsafe retry mode of the client, wait for its backoff, and share its
+// maximum number of retries and elapsed time with the other retries of the
+// call.
+func RetryTruncatedBody() JSONOption {
+	return func(jc *jsonConfig) {
+		jc.retryTruncated = true
+	}
+}
+
+// GetJSON sends a GET request to url with c and decodes the JSON response
+// into a T. See DoJSON.
+func GetJSON[T any](ctx context.Context, c *Client, url string, opts ...JSONOption) (T, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return DoJSON[T](c, req, opts...)
+}
+
+// PostJSON encodes body as JSON, sends it in a POST request to url with c,
+// and decodes the JSON response into a Resp. See DoJSON.
+func PostJSON[Req, Resp any](ctx context.Context, c *Client, url string, body Req, opts ...JSONOption) (Resp, error) {
+	var zero Resp
+	data, err := json.Marshal(body)
+	if err != nil {
+		return zero, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return zero, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return DoJSON[Resp](c, req, opts...)
+}
+
+// DoJSON sends req with c and decodes the JSON response into a T. It sets the
+// Accept header, and the Content-Type header if req has a body and none is
+// set. A response with a status outside of the 2xx range is returned as an
+// *HTTPError, and a body larger than the maximum response size as
+// ErrResponseTooLarge. A 204 No Content response decodes to the zero value.
+//
+// The *HTTPError holds the start of the body of the last response even when
+// Do retried it until it ran out of retries, as it does for every 4xx status
+// with DefaultRetryCondition. In that case, it wraps ErrMaxRetriesExceeded.
+// An invalid option is reported as an error wrapping ErrInvalidOption,
+// before the request is sent.
+func DoJSON[T any](c *Client, req *http.Request, opts ...JSONOption) (T, error) {
+	jc := jsonConfig{maxSize: 10 << 20}
+	for _, opt := range opts {
+		opt(&jc)
+	}
+	if jc.err != nil {
+		var zero T
+		return zero, jc.err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if req.Body != nil && req.Body != http.NoBody && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Count the attempts, and keep the start of the body of error responses,
+	// since Do closes it before retrying or giving up. Like Do, leave out the
+	// first 401 of each pass when there is a token source, which only gets
+	// the token refreshed.
+	cfg := c.cfg.Load()
+	var attempts int
+	var refreshed bool
+	var snippet []byte
+	track := WithAttemptMiddleware(func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			if cfg.tokens != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized && !refreshed {
+				refreshed = true
+			} else {
+				attempts++
+			}
+			snippet = nil
+			if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+				snippet = peekBody(resp, httpErrorSnippetSize)
+			}
+			return resp, err
+		})
+	})
+
+	// Every pass goes through Do, limited to what is left of the budget of
+	// the call.
+	start := cfg.clock.Now()
+	backoff := cfg.initialBackoff
+	pass := c.With(track)
+	for {
+		refreshed = false
+		v, err := doJSON[T](pass, req, jc.maxSize, &snippet)
+		if !jc.retryTruncated || !errors.Is(err, io.ErrUnexpectedEOF) || !cfg.methodRetryable(req.Method) {
+			return v, err
+		}
+		if ok, _ := cfg.unsafeRetryAllowed(req, err); !ok {
+			return v, err
+		}
+		retries := cfg.maxRetries - attempts
+		if retries < 0 {
+			return v, err
+		}
+		if cfg.maxElapsedTime > 0 && cfg.clock.Now().Sub(start)+backoff > cfg.maxElapsedTime {
+			return v, err
+		}
+
+		if err := cfg.sleep(req.Context(), backoff); err != nil {
+			return v, err
+		}
+		backoff = cfg.nextBackoff(backoff)
+
+		opts := []Option{track, WithMaxRetries(retries)}
+		if cfg.maxElapsedTime > 0 {
+			// Zero would mean no limit at all.
+			opts = append(opts, WithMaxElapsedTime(max(cfg.maxElapsedTime-cfg.clock.Now().Sub(start), time.Nanosecond)))
+		}
+		pass = c.With(opts...)
+
+		// Do has buffered the body, so it can be sent again.
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return v, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// doJSON sends req once through Do, and decodes the response. snippet holds
+// the start of the body of the last attempt, if it failed.
+func doJSON[T any](c *Client, req *http.Request, maxSize int64, snippet *[]byte) (T, error) {
+	var v T
+	resp, err := c.Do(req)
+	if err != nil {
+		if resp != nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+			return v, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Header: resp.Header, Body: *snippet, err: err}
+		}
+		return v, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return v, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Header: resp.Header, Body: *snippet}
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return v, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return v, fmt.Errorf("reading response body: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return v, fmt.Errorf("%w: body exceeds %d bytes", ErrResponseTooLarge, maxSize)
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return v, fmt.Errorf("decoding response body: %w", err)
+	}
+	return v, nil
+}
+
+// peekBody returns up to n bytes from the start of the body of resp, which
+// is left to be read in full.
+func peekBody(resp *http.Response, n int64) []byte {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, n))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+	return data
+}
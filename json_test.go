@@ -0,0 +1,209 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+type widget struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestJSONHelpers(t *testing.T) {
+	ctx := context.Background()
+	newClient := func(srv *retryhttptest.Server) *retryhttp.Client {
+		return retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithInitialBackoff(0),
+		)
+	}
+
+	t.Run("GetJSON", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{Body: `{"id":1,"name":"bolt"}`})
+		defer srv.Close()
+
+		w, err := retryhttp.GetJSON[widget](ctx, newClient(srv), srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if w != (widget{ID: 1, Name: "bolt"}) {
+			t.Fatalf("unexpected widget %+v", w)
+		}
+		if got := srv.Requests()[0].Header.Get("Accept"); got != "application/json" {
+			t.Fatalf("expected Accept application/json, got %q", got)
+		}
+	})
+
+	t.Run("PostJSON", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusServiceUnavailable},
+			retryhttptest.Step{Status: http.StatusCreated, Body: `{"id":2,"name":"nut"}`},
+		)
+		defer srv.Close()
+
+		w, err := retryhttp.PostJSON[widget, widget](ctx, newClient(srv), srv.URL, widget{Name: "nut"})
+		if err != nil || w.ID != 2 {
+			t.Fatalf("expected the created widget, got %+v, %v", w, err)
+		}
+		for _, req := range srv.Requests() {
+			if req.Header.Get("Content-Type") != "application/json" || string(req.Body) != `{"id":0,"name":"nut"}` {
+				t.Fatalf("expected the JSON body on every attempt, got %q with %q", req.Body, req.Header.Get("Content-Type"))
+			}
+		}
+	})
+
+	t.Run("Truncated bodies", func(t *testing.T) {
+		body := `{"id":3,"name":"washer"}`
+		steps := []retryhttptest.Step{{Body: body, Truncate: true}, {Body: body}}
+
+		srv := retryhttptest.NewServer(steps...)
+		defer srv.Close()
+		if _, err := retryhttp.GetJSON[widget](ctx, newClient(srv), srv.URL); err == nil {
+			t.Fatal("expected an error without RetryTruncatedBody")
+		}
+
+		srv = retryhttptest.NewServer(steps...)
+		defer srv.Close()
+		w, err := retryhttp.GetJSON[widget](ctx, newClient(srv), srv.URL, retryhttp.RetryTruncatedBody())
+		if err != nil || w.ID != 3 {
+			t.Fatalf("expected the truncated body to be retried, got %+v, %v", w, err)
+		}
+		srv.AssertAttempts(t, 2)
+	})
+
+	t.Run("Truncated bodies share the retry budget", func(t *testing.T) {
+		body := `{"id":3,"name":"washer"}`
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusServiceUnavailable},
+			retryhttptest.Step{Body: body, Truncate: true},
+			retryhttptest.Step{Status: http.StatusServiceUnavailable},
+			retryhttptest.Step{Body: body, Truncate: true},
+			retryhttptest.Step{Body: body},
+		)
+		defer srv.Close()
+
+		client := newClient(srv).With(retryhttp.WithMaxRetries(3))
+		if _, err := retryhttp.GetJSON[widget](ctx, client, srv.URL, retryhttp.RetryTruncatedBody()); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected the truncated body error, got: %v", err)
+		}
+		srv.AssertAttempts(t, 4)
+	})
+
+	t.Run("Token refresh is not a retry", func(t *testing.T) {
+		body := `{"id":3,"name":"washer"}`
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusUnauthorized},
+			retryhttptest.Step{Body: body, Truncate: true},
+			retryhttptest.Step{Body: body},
+		)
+		defer srv.Close()
+
+		client := newClient(srv).With(
+			retryhttp.WithMaxRetries(1),
+			retryhttp.WithTokenSource(retryhttp.TokenSourceFunc(func(context.Context) (string, error) {
+				return "token", nil
+			})),
+		)
+		w, err := retryhttp.GetJSON[widget](ctx, client, srv.URL, retryhttp.RetryTruncatedBody())
+		if err != nil || w.ID != 3 {
+			t.Fatalf("expected the truncated body to be retried, got %+v, %v", w, err)
+		}
+		srv.AssertAttempts(t, 3)
+	})
+
+	t.Run("Truncated bodies follow the retry policy", func(t *testing.T) {
+		for name, opt := range map[string]retryhttp.Option{
+			"Unsafe retry":     retryhttp.WithUnsafeRetry(retryhttp.UnsafeRetryNotSent),
+			"Retryable method": retryhttp.WithRetryableMethods(http.MethodGet),
+		} {
+			t.Run(name, func(t *testing.T) {
+				body := `{"id":4,"name":"gear"}`
+				srv := retryhttptest.NewServer(retryhttptest.Step{Body: body, Truncate: true}, retryhttptest.Step{Body: body})
+				defer srv.Close()
+
+				client := newClient(srv).With(opt, retryhttp.WithMaxRetries(3))
+				_, err := retryhttp.PostJSON[widget, widget](ctx, client, srv.URL, widget{Name: "gear"}, retryhttp.RetryTruncatedBody())
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("expected the truncated body error, got: %v", err)
+				}
+				srv.AssertAttempts(t, 1)
+			})
+		}
+	})
+
+	t.Run("HTTPError", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{
+			Status: http.StatusNotFound,
+			Header: http.Header{"X-Request-Id": {"abc"}},
+			Body:   `{"error":"no such widget"}` + strings.Repeat(" ", 8<<10),
+		})
+		defer srv.Close()
+
+		_, err := retryhttp.GetJSON[widget](ctx, newClient(srv), srv.URL)
+		var httpErr *retryhttp.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("expected an HTTPError, got: %v", err)
+		}
+		if httpErr.StatusCode != http.StatusNotFound || httpErr.Header.Get("X-Request-Id") != "abc" || len(httpErr.Body) != 4<<10 {
+			t.Fatalf("unexpected HTTPError %d, %v, %d bytes", httpErr.StatusCode, httpErr.Header, len(httpErr.Body))
+		}
+		if !strings.Contains(err.Error(), "404 Not Found: {\"error\":\"no such widget\"}") {
+			t.Fatalf("expected the status and snippet in the message, got: %v", err)
+		}
+	})
+
+	t.Run("HTTPError after running out of retries", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Repeat(2, retryhttptest.Step{Status: http.StatusServiceUnavailable})...)
+		defer srv.Close()
+
+		client := newClient(srv).With(retryhttp.WithMaxRetries(1))
+		_, err := retryhttp.GetJSON[widget](ctx, client, srv.URL)
+		var httpErr *retryhttp.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable || !errors.Is(err, retryhttp.ErrMaxRetriesExceeded) {
+			t.Fatalf("expected an HTTPError wrapping ErrMaxRetriesExceeded, got: %v", err)
+		}
+	})
+
+	t.Run("HTTPError with the default retry condition", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{Status: http.StatusNotFound, Body: `{"error":"no such widget"}`})
+		defer srv.Close()
+
+		// DefaultRetryCondition retries every 4xx until it runs out of retries.
+		client := retryhttp.New(retryhttp.WithClient(srv.Client()), retryhttp.WithInitialBackoff(0))
+		_, err := retryhttp.GetJSON[widget](ctx, client, srv.URL)
+		var httpErr *retryhttp.HTTPError
+		if !errors.As(err, &httpErr) || !errors.Is(err, retryhttp.ErrMaxRetriesExceeded) {
+			t.Fatalf("expected an HTTPError wrapping ErrMaxRetriesExceeded, got: %v", err)
+		}
+		if string(httpErr.Body) != `{"error":"no such widget"}` {
+			t.Fatalf("expected the body of the last attempt, got %q", httpErr.Body)
+		}
+		srv.AssertAttempts(t, 6)
+	})
+
+	t.Run("Response size cap", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{Body: `{"id":4,"name":"` + strings.Repeat("x", 100) + `"}`})
+		defer srv.Close()
+
+		_, err := retryhttp.GetJSON[widget](ctx, newClient(srv), srv.URL, retryhttp.MaxResponseSize(64))
+		if !errors.Is(err, retryhttp.ErrResponseTooLarge) {
+			t.Fatalf("expected ErrResponseTooLarge, got: %v", err)
+		}
+
+		for _, n := range []int64{0, -1} {
+			if _, err := retryhttp.GetJSON[widget](ctx, newClient(srv), srv.URL, retryhttp.MaxResponseSize(n)); !errors.Is(err, retryhttp.ErrInvalidOption) {
+				t.Fatalf("MaxResponseSize(%d): expected ErrInvalidOption, got: %v", n, err)
+			}
+		}
+		srv.AssertAttempts(t, 1)
+	})
+}
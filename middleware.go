@@ -0,0 +1,99 @@
+package retryhttp
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Doer sends HTTP requests. Both *Client and *http.Client implement it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var (
+	_ Doer = (*Client)(nil)
+	_ Doer = (*http.Client)(nil)
+)
+
+// DoerFunc adapts a function to a Doer.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f.
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware decorates a Doer, such as to log requests or to set headers. It
+// returns a Doer that does its work and calls next.
+type Middleware func(next Doer) Doer
+
+// Chain combines middlewares into one. The first one is the outermost: it
+// sees the request first, and the response last.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Doer) Doer {
+		for _, mw := range slices.Backward(middlewares) {
+			next = mw(next)
+		}
+		return next
+	}
+}
+
+// WithMiddleware adds middlewares around the retry loop. They run once per
+// call to Do, no matter how many attempts it takes, and see the final
+// response or error. Middlewares run in the order they are added, across
+// calls, the first one being the outermost.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(cfg *config) error {
+		for _, mw := range middlewares {
+			if mw == nil {
+				return invalidOption("WithMiddleware", "middleware must not be nil")
+			}
+		}
+		cfg.middleware = slices.Concat(cfg.middleware, middlewares)
+		return nil
+	}
+}
+
+// WithAttemptMiddleware adds middlewares inside the retry loop, around the
+// underlying http.Client. They run once per attempt, with the request as it
+// is sent, after the token source, the rate limiters and the signer, and
+// see the response of every attempt, including those that are retried.
+// Middlewares run in the order they are added, across calls, the first one
+// being the outermost.
+func WithAttemptMiddleware(middlewares ...Middleware) Option {
+	return func(cfg *config) error {
+		for _, mw := range middlewares {
+			if mw == nil {
+				return invalidOption("WithAttemptMiddleware", "middleware must not be nil")
+			}
+		}
+		cfg.attemptMiddleware = slices.Concat(cfg.attemptMiddleware, middlewares)
+		return nil
+	}
+}
+
+// buildMiddleware wraps the retry loop and the underlying http.Client with
+// the middlewares once, so that Do does not have to on every call.
+func (cfg *config) buildMiddleware() {
+	cfg.send = DoerFunc(cfg.do)
+	if len(cfg.middleware) > 0 {
+		cfg.send = Chain(cfg.middleware...)(cfg.send)
+	}
+	cfg.sendAttempt = nil
+	if len(cfg.attemptMiddleware) > 0 {
+		cfg.sendAttempt = Chain(cfg.attemptMiddleware...)(cfg.client)
+	}
+}
+
+// attempt returns the Doer that sends a single attempt through client.
+func (cfg *config) attempt(client *http.Client) Doer {
+	switch {
+	case len(cfg.attemptMiddleware) == 0:
+		return client
+	case client == cfg.client:
+		return cfg.sendAttempt
+	default:
+		// With address rotation, each address has its own client.
+		return Chain(cfg.attemptMiddleware...)(client)
+	}
+}
@@ -0,0 +1,165 @@
+package retryhttp_test
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+// recorder returns a middleware that appends name and the status it got to
+// log, and sets a header named after it on the request.
+func recorder(mu *sync.Mutex, log *[]string, name string) retryhttp.Middleware {
+	return func(next retryhttp.Doer) retryhttp.Doer {
+		return retryhttp.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			*log = append(*log, name+" >")
+			mu.Unlock()
+
+			req = req.Clone(req.Context())
+			req.Header.Add("X-Middleware", name)
+			resp, err := next.Do(req)
+
+			mu.Lock()
+			if resp != nil {
+				*log = append(*log, name+" < "+http.StatusText(resp.StatusCode))
+			} else {
+				*log = append(*log, name+" < error")
+			}
+			mu.Unlock()
+			return resp, err
+		})
+	}
+}
+
+func TestClient_WithMiddleware(t *testing.T) {
+	t.Run("order relative to the retry loop", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusServiceUnavailable},
+			retryhttptest.Step{Status: http.StatusOK},
+		)
+		defer srv.Close()
+
+		var mu sync.Mutex
+		var log []string
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithInitialBackoff(0),
+			retryhttp.WithMiddleware(recorder(&mu, &log, "logging"), recorder(&mu, &log, "tracing")),
+			retryhttp.WithAttemptMiddleware(recorder(&mu, &log, "attempt")),
+		)
+
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		want := []string{
+			"logging >",
+			"tracing >",
+			"attempt >",
+			"attempt < Service Unavailable",
+			"attempt >",
+			"attempt < OK",
+			"tracing < OK",
+			"logging < OK",
+		}
+		if !slices.Equal(log, want) {
+			t.Fatalf("expected calls %q, got %q", want, log)
+		}
+
+		// The outer middlewares change the request every attempt starts
+		// from; each attempt middleware only changes its own attempt.
+		for i, r := range srv.Requests() {
+			if got := r.Header.Values("X-Middleware"); !slices.Equal(got, []string{"logging", "tracing", "attempt"}) {
+				t.Fatalf("attempt %d: expected middleware headers in order, got %q", i, got)
+			}
+		}
+	})
+
+	t.Run("added across calls", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		var mu sync.Mutex
+		var log []string
+		parent := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithMiddleware(recorder(&mu, &log, "first")),
+		)
+		child := parent.With(retryhttp.WithMiddleware(recorder(&mu, &log, "second")))
+
+		resp, err := child.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		if want := []string{"first >", "second >", "second < OK", "first < OK"}; !slices.Equal(log, want) {
+			t.Fatalf("expected calls %q, got %q", want, log)
+		}
+
+		log = nil
+		resp, err = parent.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		if want := []string{"first >", "first < OK"}; !slices.Equal(log, want) {
+			t.Fatalf("expected the parent to keep its own middlewares %q, got %q", want, log)
+		}
+	})
+
+	t.Run("short circuit", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		errDenied := errors.New("denied")
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithMiddleware(func(retryhttp.Doer) retryhttp.Doer {
+				return retryhttp.DoerFunc(func(*http.Request) (*http.Response, error) {
+					return nil, errDenied
+				})
+			}),
+		)
+		if _, err := client.Get(srv.URL); !errors.Is(err, errDenied) {
+			t.Fatalf("expected the middleware error, got: %v", err)
+		}
+		if n := srv.Attempts(); n != 0 {
+			t.Fatalf("expected no requests, got %d", n)
+		}
+	})
+
+	t.Run("nil middleware", func(t *testing.T) {
+		if _, err := retryhttp.NewE(retryhttp.WithMiddleware(nil)); !errors.Is(err, retryhttp.ErrInvalidOption) {
+			t.Fatalf("expected ErrInvalidOption, got: %v", err)
+		}
+		if _, err := retryhttp.NewE(retryhttp.WithAttemptMiddleware(nil)); !errors.Is(err, retryhttp.ErrInvalidOption) {
+			t.Fatalf("expected ErrInvalidOption, got: %v", err)
+		}
+	})
+}
+
+func TestChain(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	final := retryhttp.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		log = append(log, "send "+req.Header.Get("X-Middleware"))
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	chained := retryhttp.Chain(recorder(&mu, &log, "a"), recorder(&mu, &log, "b"))(final)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := chained.Do(req); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if want := []string{"a >", "b >", "send a", "b < OK", "a < OK"}; !slices.Equal(log, want) {
+		t.Fatalf("expected calls %q, got %q", want, log)
+	}
+}
@@ -0,0 +1,333 @@
+package retryhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a serializable description of a client's retry behavior. It can
+// be loaded from JSON or from environment variables, so retries can be tuned
+// without rebuilding the program, and applied to a client with WithPolicy.
+type Policy struct {
+	// MaxRetries is the maximum number of retries after the first attempt.
+	MaxRetries int `json:"max_retries"`
+
+	// BackoffStrategy, InitialBackoff, BackoffMultiplier and MaxBackoff
+	// control the wait between attempts. When MaxBackoff is omitted from the
+	// JSON or the environment, it is two seconds, or InitialBackoff if that
+	// is longer, as with the options.
+	BackoffStrategy   BackoffStrategy `json:"backoff_strategy"`
+	InitialBackoff    Duration        `json:"initial_backoff"`
+	BackoffMultiplier float64         `json:"backoff_multiplier"`
+	MaxBackoff        Duration        `json:"max_backoff"`
+
+	// RetryableStatuses lists the status codes that are retried, in addition
+	// to network errors. When empty, DefaultRetryCondition is used.
+	RetryableStatuses []int `json:"retryable_statuses,omitempty"`
+
+	// RetryableMethods lists the methods that are retried. When empty, every
+	// method is retried.
+	RetryableMethods []string `json:"retryable_methods,omitempty"`
+
+	// RespectRetryAfter honors the Retry-After header, capped at
+	// MaxRetryAfter unless it is zero.
+	RespectRetryAfter bool     `json:"respect_retry_after,omitempty"`
+	MaxRetryAfter     Duration `json:"max_retry_after,omitempty"`
+
+	// MaxElapsedTime limits the total time spent on a request. Zero means
+	// no limit.
+	MaxElapsedTime Duration `json:"max_elapsed_time,omitempty"`
+
+	// AdaptiveRetry turns on adaptive mode, which slows the send rate to a
+	// host down when it throttles and back up as requests succeed.
+	AdaptiveRetry bool `json:"adaptive_retry,omitempty"`
+
+	// UnsafeRetry sets when requests with a non-idempotent method are
+	// retried: "always", the default, or "not_sent" to only retry them when
+	// they provably never reached the server.
+	UnsafeRetry UnsafeRetryMode `json:"unsafe_retry,omitempty"`
+}
+
+// DefaultPolicy returns the policy used by a client created with New and no
+// options.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxRetries:        5,
+		BackoffStrategy:   BackoffExponential,
+		InitialBackoff:    Duration(100 * time.Millisecond),
+		BackoffMultiplier: 2,
+		MaxBackoff:        Duration(2 * time.Second),
+	}
+}
+
+// Validate reports every problem with the policy, joined into a single error.
+func (p Policy) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if p.MaxRetries < 0 {
+		fail("max_retries", "must not be negative, got %d", p.MaxRetries)
+	}
+	if !p.BackoffStrategy.valid() {
+		fail("backoff_strategy", "must be one of %q, %q or %q, got %q", BackoffExponential, BackoffLinear, BackoffConstant, p.BackoffStrategy)
+	}
+	if p.InitialBackoff < 0 {
+		fail("initial_backoff", "must not be negative, got %s", p.InitialBackoff)
+	}
+	if p.BackoffStrategy == BackoffExponential && p.BackoffMultiplier < 1 {
+		fail("backoff_multiplier", "must be at least 1 for exponential backoff, got %g", p.BackoffMultiplier)
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		fail("max_backoff", "must not be smaller than initial_backoff (%s), got %s", p.InitialBackoff, p.MaxBackoff)
+	}
+	for _, code := range p.RetryableStatuses {
+		if code < 100 || code > 599 {
+			fail("retryable_statuses", "%d is not a valid HTTP status code", code)
+		}
+	}
+	for _, method := range p.RetryableMethods {
+		if !validMethod(method) {
+			fail("retryable_methods", "%q is not a valid HTTP method", method)
+		}
+	}
+	if p.MaxRetryAfter < 0 {
+		fail("max_retry_after", "must not be negative, got %s", p.MaxRetryAfter)
+	}
+	if p.MaxElapsedTime < 0 {
+		fail("max_elapsed_time", "must not be negative, got %s", p.MaxElapsedTime)
+	}
+	if !p.UnsafeRetry.valid() {
+		fail("unsafe_retry", "must be %q or %q, got %q", UnsafeRetryAlways, UnsafeRetryNotSent, p.UnsafeRetry)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid retry policy: %w", errors.Join(errs...))
+}
+
+// UnmarshalJSON decodes a policy on top of DefaultPolicy, so omitted fields
+// keep their default values. Unknown fields and invalid policies are errors.
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	type plain Policy
+	decoded := plain(DefaultPolicy())
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&decoded); err != nil {
+		return fmt.Errorf("invalid retry policy: %w", err)
+	}
+	var set struct {
+		MaxBackoff *Duration `json:"max_backoff"`
+	}
+	if err := json.Unmarshal(data, &set); err == nil && set.MaxBackoff == nil {
+		decoded.MaxBackoff = max(decoded.MaxBackoff, decoded.InitialBackoff)
+	}
+	if err := Policy(decoded).Validate(); err != nil {
+		return err
+	}
+	*p = Policy(decoded)
+	return nil
+}
+
+// PolicyFromEnv returns DefaultPolicy overridden by any of the following
+// environment variables, each name starting with prefix:
+//
+//	MAX_RETRIES          integer
+//	BACKOFF_STRATEGY     exponential, linear or constant
+//	INITIAL_BACKOFF      duration, such as "250ms"
+//	BACKOFF_MULTIPLIER   number
+//	MAX_BACKOFF          duration
+//	RETRYABLE_STATUSES   comma-separated status codes
+//	RETRYABLE_METHODS    comma-separated methods
+//	RESPECT_RETRY_AFTER  boolean
+//	MAX_RETRY_AFTER      duration
+//	MAX_ELAPSED_TIME     duration
+//	ADAPTIVE_RETRY       boolean
+//	UNSAFE_RETRY         always or not_sent
+//
+// For example, with the prefix "MYAPP_RETRY_", the maximum number of retries
+// is read from MYAPP_RETRY_MAX_RETRIES.
+func PolicyFromEnv(prefix string) (Policy, error) {
+	p := DefaultPolicy()
+	var errs []error
+
+	lookup := func(name string, parse func(string) error) {
+		key := prefix + name
+		value, ok := os.LookupEnv(key)
+		if !ok || strings.TrimSpace(value) == "" {
+			return
+		}
+		if err := parse(strings.TrimSpace(value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	duration := func(dst *Duration) func(string) error {
+		return func(s string) error {
+			return dst.parse(s)
+		}
+	}
+
+	lookup("MAX_RETRIES", func(s string) (err error) {
+		p.MaxRetries, err = strconv.Atoi(s)
+		return err
+	})
+	lookup("BACKOFF_STRATEGY", func(s string) error {
+		p.BackoffStrategy = BackoffStrategy(strings.ToLower(s))
+		return nil
+	})
+	lookup("INITIAL_BACKOFF", duration(&p.InitialBackoff))
+	lookup("BACKOFF_MULTIPLIER", func(s string) (err error) {
+		p.BackoffMultiplier, err = strconv.ParseFloat(s, 64)
+		return err
+	})
+	maxBackoffSet := false
+	lookup("MAX_BACKOFF", func(s string) error {
+		maxBackoffSet = true
+		return p.MaxBackoff.parse(s)
+	})
+	lookup("RETRYABLE_STATUSES", func(s string) error {
+		p.RetryableStatuses = nil
+		for _, part := range strings.Split(s, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return err
+			}
+			p.RetryableStatuses = append(p.RetryableStatuses, code)
+		}
+		return nil
+	})
+	lookup("RETRYABLE_METHODS", func(s string) error {
+		p.RetryableMethods = nil
+		for _, part := range strings.Split(s, ",") {
+			p.RetryableMethods = append(p.RetryableMethods, strings.ToUpper(strings.TrimSpace(part)))
+		}
+		return nil
+	})
+	lookup("RESPECT_RETRY_AFTER", func(s string) (err error) {
+		p.RespectRetryAfter, err = strconv.ParseBool(s)
+		return err
+	})
+	lookup("MAX_RETRY_AFTER", duration(&p.MaxRetryAfter))
+	lookup("MAX_ELAPSED_TIME", duration(&p.MaxElapsedTime))
+	lookup("ADAPTIVE_RETRY", func(s string) (err error) {
+		p.AdaptiveRetry, err = strconv.ParseBool(s)
+		return err
+	})
+	lookup("UNSAFE_RETRY", func(s string) error {
+		p.UnsafeRetry = UnsafeRetryMode(strings.ToLower(s))
+		return nil
+	})
+
+	if !maxBackoffSet {
+		p.MaxBackoff = max(p.MaxBackoff, p.InitialBackoff)
+	}
+
+	if len(errs) > 0 {
+		return Policy{}, fmt.Errorf("invalid retry policy environment: %w", errors.Join(errs...))
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// WithPolicy applies every setting of p to the client. The option fails if
+// the policy does not pass Validate.
+func WithPolicy(p Policy) Option {
+	return func(cfg *config) error {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("%w: WithPolicy: %w", ErrInvalidOption, err)
+		}
+
+		cfg.maxRetries = p.MaxRetries
+		cfg.backoffStrategy = p.BackoffStrategy
+		cfg.initialBackoff = time.Duration(p.InitialBackoff)
+		cfg.backoffMultiplier = p.BackoffMultiplier
+		cfg.maxBackoff = time.Duration(p.MaxBackoff)
+		cfg.maxBackoffSet = true
+		cfg.maxElapsedTime = time.Duration(p.MaxElapsedTime)
+
+		cfg.retryCondition = DefaultRetryCondition
+		if len(p.RetryableStatuses) > 0 {
+			cfg.retryCondition = RetryOnStatuses(p.RetryableStatuses...)
+		}
+
+		cfg.retryableMethods = nil
+		if len(p.RetryableMethods) > 0 {
+			if err := WithRetryableMethods(p.RetryableMethods...)(cfg); err != nil {
+				return err
+			}
+		}
+
+		cfg.respectRetryAfter = p.RespectRetryAfter
+		cfg.maxRetryAfter = time.Duration(p.MaxRetryAfter)
+		cfg.unsafeRetry = p.UnsafeRetry
+
+		// Keep what adaptive mode learned so far if it stays on.
+		switch {
+		case !p.AdaptiveRetry:
+			cfg.adaptive = nil
+		case cfg.adaptive == nil:
+			cfg.adaptive = &adaptiveLimiter{}
+		}
+		return nil
+	}
+}
+
+// NewFromPolicy creates a client from p. Any additional options are applied
+// after the policy. It is a shorthand for NewE with WithPolicy.
+func NewFromPolicy(p Policy, opts ...Option) (*Client, error) {
+	return NewE(append([]Option{WithPolicy(p)}, opts...)...)
+}
+
+// validMethod reports whether method is a valid HTTP method token.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, r := range method {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Duration is a time.Duration that is written to and read from JSON as a
+// string such as "1.5s".
+type Duration time.Duration
+
+// String returns the duration formatted like time.Duration.
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a duration string such as "250ms" or "2s".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1s\", got %s", data)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,211 @@
+package retryhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Run("JSON round trip", func(t *testing.T) {
+		p := DefaultPolicy()
+		p.BackoffStrategy = BackoffLinear
+		p.RetryableStatuses = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+		p.RetryableMethods = []string{http.MethodGet}
+		p.RespectRetryAfter = true
+		p.MaxRetryAfter = Duration(30 * time.Second)
+		p.MaxElapsedTime = Duration(time.Minute)
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("failed to marshal policy: %v", err)
+		}
+		if !strings.Contains(string(data), `"max_retry_after":"30s"`) {
+			t.Fatalf("expected durations to be encoded as strings, got %s", data)
+		}
+
+		var decoded Policy
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("failed to unmarshal policy: %v", err)
+		}
+		if !reflect.DeepEqual(p, decoded) {
+			t.Fatalf("expected %+v, got %+v", p, decoded)
+		}
+	})
+
+	t.Run("Omitted JSON fields keep defaults", func(t *testing.T) {
+		var p Policy
+		if err := json.Unmarshal([]byte(`{"max_retries": 2}`), &p); err != nil {
+			t.Fatalf("failed to unmarshal policy: %v", err)
+		}
+		expected := DefaultPolicy()
+		expected.MaxRetries = 2
+		if !reflect.DeepEqual(p, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, p)
+		}
+	})
+
+	t.Run("Omitted max backoff follows the initial backoff", func(t *testing.T) {
+		var p Policy
+		if err := json.Unmarshal([]byte(`{"initial_backoff":"3s"}`), &p); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if p.MaxBackoff != Duration(3*time.Second) {
+			t.Fatalf("expected max backoff 3s, got %s", p.MaxBackoff)
+		}
+		if err := json.Unmarshal([]byte(`{"initial_backoff":"3s","max_backoff":"2s"}`), &p); err == nil {
+			t.Fatal("expected an error for an explicit max backoff below the initial backoff")
+		}
+
+		t.Setenv("TEST_RETRY_INITIAL_BACKOFF", "3s")
+		p, err := PolicyFromEnv("TEST_RETRY_")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if p.MaxBackoff != Duration(3*time.Second) {
+			t.Fatalf("expected max backoff 3s, got %s", p.MaxBackoff)
+		}
+		t.Setenv("TEST_RETRY_MAX_BACKOFF", "2s")
+		if _, err := PolicyFromEnv("TEST_RETRY_"); err == nil {
+			t.Fatal("expected an error for an explicit max backoff below the initial backoff")
+		}
+	})
+
+	t.Run("Invalid JSON policy reports every problem", func(t *testing.T) {
+		var p Policy
+		err := json.Unmarshal([]byte(`{
+			"max_retries": -1,
+			"backoff_multiplier": 0.5,
+			"initial_backoff": "5s",
+			"max_backoff": "1s",
+			"retryable_statuses": [42],
+			"unsafe_retry": "sometimes"
+		}`), &p)
+		if err == nil {
+			t.Fatal("expected an error for an invalid policy")
+		}
+		for _, field := range []string{"max_retries", "backoff_multiplier", "max_backoff", "retryable_statuses", "unsafe_retry"} {
+			if !strings.Contains(err.Error(), field) {
+				t.Errorf("expected error to mention %q, got: %v", field, err)
+			}
+		}
+	})
+
+	t.Run("Unknown fields and bad durations are rejected", func(t *testing.T) {
+		var p Policy
+		if err := json.Unmarshal([]byte(`{"max_retry": 3}`), &p); err == nil {
+			t.Fatal("expected an error for an unknown field")
+		}
+		if err := json.Unmarshal([]byte(`{"max_backoff": 1000}`), &p); err == nil {
+			t.Fatal("expected an error for a numeric duration")
+		}
+	})
+
+	t.Run("Environment variables", func(t *testing.T) {
+		t.Setenv("TEST_RETRY_MAX_RETRIES", "7")
+		t.Setenv("TEST_RETRY_BACKOFF_STRATEGY", "Constant")
+		t.Setenv("TEST_RETRY_INITIAL_BACKOFF", "250ms")
+		t.Setenv("TEST_RETRY_RETRYABLE_STATUSES", "429, 503")
+		t.Setenv("TEST_RETRY_RETRYABLE_METHODS", "get,head")
+		t.Setenv("TEST_RETRY_RESPECT_RETRY_AFTER", "true")
+		t.Setenv("TEST_RETRY_ADAPTIVE_RETRY", "1")
+		t.Setenv("TEST_RETRY_UNSAFE_RETRY", "NOT_SENT")
+
+		p, err := PolicyFromEnv("TEST_RETRY_")
+		if err != nil {
+			t.Fatalf("failed to load policy: %v", err)
+		}
+		expected := DefaultPolicy()
+		expected.MaxRetries = 7
+		expected.BackoffStrategy = BackoffConstant
+		expected.InitialBackoff = Duration(250 * time.Millisecond)
+		expected.RetryableStatuses = []int{429, 503}
+		expected.RetryableMethods = []string{"GET", "HEAD"}
+		expected.RespectRetryAfter = true
+		expected.AdaptiveRetry = true
+		expected.UnsafeRetry = UnsafeRetryNotSent
+		if !reflect.DeepEqual(p, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, p)
+		}
+	})
+
+	t.Run("Invalid environment variables name the variable", func(t *testing.T) {
+		t.Setenv("TEST_RETRY_MAX_RETRIES", "many")
+		t.Setenv("TEST_RETRY_MAX_BACKOFF", "soon")
+
+		_, err := PolicyFromEnv("TEST_RETRY_")
+		if err == nil {
+			t.Fatal("expected an error for invalid environment variables")
+		}
+		for _, key := range []string{"TEST_RETRY_MAX_RETRIES", "TEST_RETRY_MAX_BACKOFF"} {
+			if !strings.Contains(err.Error(), key) {
+				t.Errorf("expected error to mention %q, got: %v", key, err)
+			}
+		}
+	})
+
+	t.Run("NewFromPolicy", func(t *testing.T) {
+		p := DefaultPolicy()
+		p.MaxRetries = 1
+		p.RetryableStatuses = []int{http.StatusServiceUnavailable}
+		p.RetryableMethods = []string{http.MethodGet}
+		p.AdaptiveRetry = true
+
+		client, err := NewFromPolicy(p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if client.cfg.Load().maxRetries != 1 {
+			t.Fatalf("expected max retries 1, got %d", client.cfg.Load().maxRetries)
+		}
+		if !client.cfg.Load().retryCondition(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil) {
+			t.Fatal("expected 503 to be retryable")
+		}
+		if client.cfg.Load().retryCondition(&http.Response{StatusCode: http.StatusForbidden}, nil) {
+			t.Fatal("expected 403 not to be retryable")
+		}
+		if client.cfg.Load().methodRetryable(http.MethodPost) {
+			t.Fatal("expected POST not to be retryable")
+		}
+		if client.cfg.Load().adaptive == nil {
+			t.Fatal("expected adaptive mode to be on")
+		}
+
+		p.MaxRetries = -3
+		if _, err := NewFromPolicy(p); err == nil {
+			t.Fatal("expected an error for an invalid policy")
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second, true},
+		{now.Add(-10 * time.Second).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tc := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if tc.header != "" {
+			resp.Header.Set("Retry-After", tc.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tc.expected || ok != tc.ok {
+			t.Errorf("Retry-After %q: expected (%v, %v), got (%v, %v)", tc.header, tc.expected, tc.ok, got, ok)
+		}
+	}
+	if _, ok := retryAfter(nil, now); ok {
+		t.Error("expected no Retry-After for a nil response")
+	}
+}
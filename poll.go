@@ -0,0 +1,168 @@
+package retryhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrMaxPollsExceeded is returned by Poll when the operation is not done
+// after the maximum number of polls.
+var ErrMaxPollsExceeded = errors.New("max polls exceeded")
+
+// ErrMaxPollDurationExceeded is returned by Poll when waiting for another
+// poll would exceed the maximum poll duration.
+var ErrMaxPollDurationExceeded = errors.New("max poll duration exceeded")
+
+// PollDoneFunc decides from a poll response whether the operation is over.
+// It returns true when the operation is complete, or an error when it failed,
+// which ends the polling. It may read the response body, but must not close
+// it.
+type PollDoneFunc func(resp *http.Response) (bool, error)
+
+// PollOption configures a single call to Poll.
+type PollOption func(*pollConfig)
+
+// pollConfig holds the settings of a call to Poll.
+type pollConfig struct {
+	interval    time.Duration
+	maxPolls    int
+	maxDuration time.Duration
+	err         error
+}
+
+// PollInterval sets the wait between polls when the server does not ask
+// for one with Retry-After. The default is one second.
+func PollInterval(d time.Duration) PollOption {
+	return func(pc *pollConfig) {
+		if d <= 0 {
+			pc.err = invalidOption("PollInterval", "interval must be positive, got %s", d)
+			return
+		}
+		pc.interval = d
+	}
+}
+
+// MaxPolls limits the number of polls, the first request included. Zero,
+// the default, means no limit.
+func MaxPolls(n int) PollOption {
+	return func(pc *pollConfig) {
+		if n < 0 {
+			pc.err = invalidOption("MaxPolls", "max polls must not be negative, got %d", n)
+			return
+		}
+		pc.maxPolls = n
+	}
+}
+
+// MaxPollDuration limits the total time spent polling. Zero, the
+// default, means no limit other than the context.
+func MaxPollDuration(d time.Duration) PollOption {
+	return func(pc *pollConfig) {
+		if d < 0 {
+			pc.err = invalidOption("MaxPollDuration", "max duration must not be negative, got %s", d)
+			return
+		}
+		pc.maxDuration = d
+	}
+}
+
+// Poll sends req, then polls until done reports that the operation is over,
+// as is common with APIs that answer 202 Accepted to start a long-running
+// operation. If done is nil, polling stops at the first response that is not
+// 202 Accepted.
+//
+// Every poll goes through Do, so transient failures are retried without
+// ending the polling. When a response has a Location header, the following
+// polls are GET requests to that URL, with the headers of req; otherwise,
+// req is sent again. Between polls, Poll waits for as long as the Retry-After
+// header says, or else for the poll interval.
+//
+// The response that completes the operation is returned with its body open.
+// If done returns an error, it is returned as it is. An invalid option is
+// reported as an error wrapping ErrInvalidOption, before the first request.
+func (c *Client) Poll(ctx context.Context, req *http.Request, done PollDoneFunc, opts ...PollOption) (*http.Response, error) {
+	pc := pollConfig{interval: time.Second}
+	for _, opt := range opts {
+		opt(&pc)
+	}
+	if pc.err != nil {
+		return nil, pc.err
+	}
+	if done == nil {
+		done = func(resp *http.Response) (bool, error) {
+			return resp.StatusCode != http.StatusAccepted, nil
+		}
+	}
+
+	cfg := c.cfg.Load()
+	start := cfg.clock.Now()
+	preq := req.WithContext(ctx)
+
+	for polls := 1; ; polls++ {
+		resp, err := c.Do(preq)
+		if err != nil {
+			return nil, err
+		}
+
+		finished, err := done(resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if finished {
+			return resp, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		if pc.maxPolls > 0 && polls >= pc.maxPolls {
+			return nil, fmt.Errorf("%w: operation not done after %d polls", ErrMaxPollsExceeded, polls)
+		}
+
+		wait := pc.interval
+		if d, ok := retryAfter(resp, cfg.clock.Now()); ok {
+			wait = d
+			if cfg.maxRetryAfter > 0 && wait > cfg.maxRetryAfter {
+				wait = cfg.maxRetryAfter
+			}
+		}
+		if pc.maxDuration > 0 && cfg.clock.Now().Sub(start)+wait > pc.maxDuration {
+			return nil, fmt.Errorf("%w: operation not done after %s", ErrMaxPollDurationExceeded, pc.maxDuration)
+		}
+
+		if preq, err = nextPoll(ctx, req, preq, resp); err != nil {
+			return nil, err
+		}
+		if err := cfg.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// nextPoll returns the request for the poll after prev, which got resp.
+func nextPoll(ctx context.Context, orig, prev *http.Request, resp *http.Response) (*http.Request, error) {
+	if loc, err := resp.Location(); err == nil {
+		next, err := http.NewRequestWithContext(ctx, http.MethodGet, loc.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		next.Header = orig.Header.Clone()
+		next.Header.Del("Content-Type")
+		next.Header.Del("Content-Length")
+		return next, nil
+	}
+
+	next := prev.Clone(ctx)
+	if prev.GetBody != nil {
+		body, err := prev.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
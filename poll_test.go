@@ -0,0 +1,145 @@
+package retryhttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_Poll(t *testing.T) {
+	accepted := func(retryAfter string) retryhttptest.Step {
+		step := retryhttptest.Step{Status: http.StatusAccepted, Header: http.Header{}}
+		if retryAfter != "" {
+			step.Header.Set("Retry-After", retryAfter)
+		}
+		return step
+	}
+
+	t.Run("Follows Location and Retry-After", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+		srv.Handle("/jobs", retryhttptest.Step{
+			Status: http.StatusAccepted,
+			Header: http.Header{"Location": {"/jobs/1"}, "Retry-After": {"3"}},
+		})
+		srv.Handle("/jobs/1",
+			accepted(""),
+			retryhttptest.Step{Status: http.StatusServiceUnavailable},
+			retryhttptest.Step{Body: `{"state":"succeeded"}`},
+		)
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+		)
+
+		type result struct {
+			resp *http.Response
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/jobs", strings.NewReader(`{"task":"export"}`))
+			req.Header.Set("Authorization", "Bearer token")
+			resp, err := client.Poll(context.Background(), req, nil, retryhttp.PollInterval(5*time.Second))
+			done <- result{resp, err}
+		}()
+		for i := 0; i < 3; i++ {
+			clock.BlockUntil(1)
+			clock.AdvanceToNext()
+		}
+		res := <-done
+		if res.err != nil {
+			t.Fatalf("expected no error, got: %v", res.err)
+		}
+		defer res.resp.Body.Close()
+
+		var status struct{ State string }
+		if err := json.NewDecoder(res.resp.Body).Decode(&status); err != nil || status.State != "succeeded" {
+			t.Fatalf("expected the final response to be returned, got %+v, %v", status, err)
+		}
+
+		// Retry-After, then the interval, then the backoff of the retry.
+		expected := []time.Duration{3 * time.Second, 5 * time.Second, 100 * time.Millisecond}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+		requests := srv.Requests()
+		if len(requests) != 4 || requests[1].Method != http.MethodGet || requests[1].Header.Get("Authorization") != "Bearer token" {
+			t.Fatalf("expected authenticated GET polls of the Location, got %+v", requests)
+		}
+	})
+
+	t.Run("Done function reports failures", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{Body: `{"state":"failed"}`})
+		defer srv.Close()
+
+		errFailed := errors.New("operation failed")
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		_, err := retryhttp.New().Poll(context.Background(), req, func(resp *http.Response) (bool, error) {
+			var status struct{ State string }
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				return false, err
+			}
+			if status.State == "failed" {
+				return true, errFailed
+			}
+			return status.State == "succeeded", nil
+		})
+		if !errors.Is(err, errFailed) {
+			t.Fatalf("expected the error of the done function, got: %v", err)
+		}
+	})
+
+	t.Run("Max polls", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Repeat(5, accepted(""))...)
+		defer srv.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		_, err := retryhttp.New().Poll(context.Background(), req, nil, retryhttp.PollInterval(time.Millisecond), retryhttp.MaxPolls(3))
+		if !errors.Is(err, retryhttp.ErrMaxPollsExceeded) {
+			t.Fatalf("expected ErrMaxPollsExceeded, got: %v", err)
+		}
+		srv.AssertAttempts(t, 3)
+	})
+
+	t.Run("Max duration", func(t *testing.T) {
+		srv := retryhttptest.NewServer(accepted("60"))
+		defer srv.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		_, err := retryhttp.New().Poll(context.Background(), req, nil, retryhttp.MaxPollDuration(time.Minute/2))
+		if !errors.Is(err, retryhttp.ErrMaxPollDurationExceeded) {
+			t.Fatalf("expected ErrMaxPollDurationExceeded, got: %v", err)
+		}
+		srv.AssertAttempts(t, 1)
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		for name, opt := range map[string]retryhttp.PollOption{
+			"zero interval":         retryhttp.PollInterval(0),
+			"negative interval":     retryhttp.PollInterval(-time.Second),
+			"negative max polls":    retryhttp.MaxPolls(-1),
+			"negative max duration": retryhttp.MaxPollDuration(-time.Second),
+		} {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if _, err := retryhttp.New().Poll(context.Background(), req, nil, opt); !errors.Is(err, retryhttp.ErrInvalidOption) {
+				t.Fatalf("%s: expected ErrInvalidOption, got: %v", name, err)
+			}
+		}
+		srv.AssertAttempts(t, 0)
+	})
+}
@@ -0,0 +1,122 @@
+package retryhttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithRateLimitHeaders makes the client track the remaining quota that
+// servers advertise in their responses, per host, and hold back new attempts
+// once it is used up, until the quota resets. This avoids running into 429
+// responses in the first place. Both the IETF draft headers
+// (RateLimit-Remaining and RateLimit-Reset, in seconds) and the common
+// X-RateLimit-Remaining and X-RateLimit-Reset headers, where the reset is a
+// Unix timestamp, are understood.
+func WithRateLimitHeaders() Option {
+	return func(cfg *config) error {
+		cfg.quota = &quotaTracker{hosts: make(map[string]*quotaState)}
+		return nil
+	}
+}
+
+// quotaState is the last known quota of a host.
+type quotaState struct {
+	remaining int
+	reset     time.Time
+}
+
+// quotaTracker keeps the advertised quota of every host seen so far.
+type quotaTracker struct {
+	mu    sync.Mutex
+	hosts map[string]*quotaState
+}
+
+// wait blocks until host has quota left, then takes one unit of it. If the
+// quota of host is unknown, it returns immediately.
+func (qt *quotaTracker) wait(ctx context.Context, cfg *config, host string) error {
+	for {
+		d := qt.acquire(host, cfg.clock.Now())
+		if d <= 0 {
+			return nil
+		}
+		if err := cfg.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// acquire takes one unit of quota for host and returns zero, or returns how
+// long to wait until the quota resets.
+func (qt *quotaTracker) acquire(host string, now time.Time) time.Duration {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	state, ok := qt.hosts[host]
+	if !ok {
+		return 0
+	}
+	if !now.Before(state.reset) {
+		// The window is over; wait for the server to tell us the new quota.
+		delete(qt.hosts, host)
+		return 0
+	}
+	if state.remaining > 0 {
+		state.remaining--
+		return 0
+	}
+	return state.reset.Sub(now)
+}
+
+// observe records the quota advertised by resp, if any.
+func (qt *quotaTracker) observe(host string, resp *http.Response, now time.Time) {
+	if resp == nil {
+		return
+	}
+	remaining, reset, ok := parseQuota(resp.Header, now)
+	if !ok {
+		return
+	}
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	qt.hosts[host] = &quotaState{remaining: remaining, reset: reset}
+}
+
+// parseQuota reads the remaining quota and its reset time from h, preferring
+// the IETF draft headers over the X-RateLimit ones.
+func parseQuota(h http.Header, now time.Time) (int, time.Time, bool) {
+	if remaining, ok := headerInt(h, "RateLimit-Remaining"); ok {
+		if seconds, ok := headerInt(h, "RateLimit-Reset"); ok {
+			return remaining, now.Add(time.Duration(seconds) * time.Second), true
+		}
+	}
+	if remaining, ok := headerInt(h, "X-RateLimit-Remaining"); ok {
+		if reset, ok := headerInt(h, "X-RateLimit-Reset"); ok {
+			// Most APIs send a Unix timestamp, but some send a number of
+			// seconds like the IETF draft. A timestamp is far larger.
+			if reset > 1_000_000_000 {
+				return remaining, time.Unix(int64(reset), 0), true
+			}
+			return remaining, now.Add(time.Duration(reset) * time.Second), true
+		}
+	}
+	return 0, time.Time{}, false
+}
+
+// headerInt parses the first value of the header name as a non-negative
+// integer.
+func headerInt(h http.Header, name string) (int, bool) {
+	value := strings.TrimSpace(h.Get(name))
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,124 @@
+package retryhttp_test
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WithRateLimitHeaders(t *testing.T) {
+	get := func(t *testing.T, client *retryhttp.Client, url string) <-chan error {
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+		return errc
+	}
+
+	t.Run("IETF draft headers", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Header: http.Header{"Ratelimit-Remaining": {"1"}, "Ratelimit-Reset": {"30"}}},
+			retryhttptest.Step{Header: http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"20"}}},
+			retryhttptest.Step{},
+		)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithRateLimitHeaders(),
+		)
+
+		// The first response advertises one request left, the second uses
+		// it up, and the third has to wait for the reset.
+		for i := 0; i < 2; i++ {
+			if err := <-get(t, client, srv.URL); err != nil {
+				t.Fatalf("request %d: expected no error, got: %v", i, err)
+			}
+		}
+		if got := len(clock.Durations()); got != 0 {
+			t.Fatalf("expected no waits while quota is left, got %d", got)
+		}
+
+		errc := get(t, client, srv.URL)
+		clock.BlockUntil(1)
+		srv.AssertAttempts(t, 2)
+		clock.AdvanceToNext()
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		expected := []time.Duration{20 * time.Second}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+		srv.AssertAttempts(t, 3)
+	})
+
+	t.Run("X-RateLimit headers with a Unix timestamp", func(t *testing.T) {
+		start := time.Unix(1_700_000_000, 0)
+		reset := strconv.FormatInt(start.Add(45*time.Second).Unix(), 10)
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {reset}}},
+			retryhttptest.Step{},
+		)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(start)
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithRateLimitHeaders(),
+		)
+
+		if err := <-get(t, client, srv.URL); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		errc := get(t, client, srv.URL)
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		expected := []time.Duration{45 * time.Second}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Quota is tracked per host", func(t *testing.T) {
+		exhausted := retryhttptest.NewServer(
+			retryhttptest.Step{Header: http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"60"}}},
+		)
+		defer exhausted.Close()
+		other := retryhttptest.NewServer()
+		defer other.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithRateLimitHeaders(),
+		)
+
+		if err := <-get(t, client, exhausted.URL); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if err := <-get(t, client, other.URL); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := len(clock.Durations()); got != 0 {
+			t.Fatalf("expected the other host not to wait, got %d waits", got)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package retryhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter throttles outgoing attempts. Wait blocks until the next attempt is
+// allowed, or returns an error if ctx is done first.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter makes every attempt, retries included, wait on l before it
+// is sent. The same limiter is used for all requests.
+func WithRateLimiter(l Limiter) Option {
+	return func(cfg *config) error {
+		if l == nil {
+			return invalidOption("WithRateLimiter", "limiter must not be nil")
+		}
+		cfg.limiter = func(*http.Request) Limiter { return l }
+		return nil
+	}
+}
+
+// WithKeyedRateLimiter makes every attempt, retries included, wait on a
+// limiter chosen by the key of its request. The first request seen for a key
+// creates its limiter with newLimiter, which is called once per key, even
+// when requests for a new key arrive concurrently. Use HostKey to get one
+// limiter per host.
+func WithKeyedRateLimiter(key func(*http.Request) string, newLimiter func(key string) Limiter) Option {
+	return func(cfg *config) error {
+		if key == nil || newLimiter == nil {
+			return invalidOption("WithKeyedRateLimiter", "key and limiter functions must not be nil")
+		}
+		registry := &limiterRegistry{key: key, newLimiter: newLimiter}
+		cfg.limiter = registry.get
+		return nil
+	}
+}
+
+// HostKey returns the host, including the port if any, of the request URL. It
+// can be used with WithKeyedRateLimiter to rate limit each host separately.
+func HostKey(req *http.Request) string {
+	return req.URL.Host
+}
+
+// limiterRegistry lazily creates one limiter per key.
+type limiterRegistry struct {
+	key        func(*http.Request) string
+	newLimiter func(key string) Limiter
+	limiters   sync.Map   // map[string]Limiter
+	creating   sync.Mutex // serializes calls to newLimiter
+}
+
+func (r *limiterRegistry) get(req *http.Request) Limiter {
+	k := r.key(req)
+	if l, ok := r.limiters.Load(k); ok {
+		return l.(Limiter)
+	}
+
+	r.creating.Lock()
+	defer r.creating.Unlock()
+	if l, ok := r.limiters.Load(k); ok {
+		return l.(Limiter)
+	}
+	l := r.newLimiter(k)
+	r.limiters.Store(k, l)
+	return l
+}
+
+// TokenBucket is a Limiter that allows rate attempts per second on average,
+// with bursts of up to burst attempts. It is safe for concurrent use.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var _ Limiter = (*TokenBucket)(nil)
+
+// NewTokenBucket returns a full token bucket that refills at rate tokens per
+// second and holds at most burst tokens. If clock is nil, real time is used.
+// It panics if rate is not positive or burst is smaller than 1.
+func NewTokenBucket(rate float64, burst int, clock Clock) *TokenBucket {
+	if rate <= 0 || burst < 1 {
+		panic(fmt.Sprintf("retryhttp: invalid token bucket rate %g or burst %d", rate, burst))
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		clock:  clock,
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// Wait takes a token from the bucket, blocking until one is available. If
+// ctx is done before that, the token is given back and the context error is
+// returned.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	wait := tb.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := tb.clock.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		tb.mu.Lock()
+		tb.tokens++
+		tb.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token, possibly going into debt, and returns how long the
+// caller has to wait for the token to actually be available.
+func (tb *TokenBucket) reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.clock.Now()
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens = min(tb.burst, tb.tokens+elapsed.Seconds()*tb.rate)
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
@@ -0,0 +1,218 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("Burst then refill", func(t *testing.T) {
+		clock := retryhttptest.NewFakeClock(time.Now())
+		tb := retryhttp.NewTokenBucket(2, 2, clock)
+
+		for i := 0; i < 2; i++ {
+			if err := tb.Wait(context.Background()); err != nil {
+				t.Fatalf("expected burst token %d, got: %v", i, err)
+			}
+		}
+		if clock.Pending() != 0 {
+			t.Fatal("expected burst tokens not to wait")
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- tb.Wait(context.Background()) }()
+		clock.BlockUntil(1)
+		if d := clock.AdvanceToNext(); d != 500*time.Millisecond {
+			t.Fatalf("expected to wait 500ms for a token, got %v", d)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("Wait respects the context", func(t *testing.T) {
+		clock := retryhttptest.NewFakeClock(time.Now())
+		tb := retryhttp.NewTokenBucket(1, 1, clock)
+		tb.Wait(context.Background())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- tb.Wait(ctx) }()
+		clock.BlockUntil(1)
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+
+		// The cancelled waiter gave its token back, so the next one only
+		// waits for the first refill.
+		go func() { done <- tb.Wait(context.Background()) }()
+		clock.BlockUntil(1)
+		if d := clock.AdvanceToNext(); d != time.Second {
+			t.Fatalf("expected to wait 1s, got %v", d)
+		}
+		<-done
+	})
+}
+
+func TestClient_WithRateLimiter(t *testing.T) {
+	t.Run("Retries are throttled", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusTooManyRequests},
+			retryhttptest.Step{Status: http.StatusOK},
+		)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithInitialBackoff(100*time.Millisecond),
+			retryhttp.WithRateLimiter(retryhttp.NewTokenBucket(1, 1, clock)),
+		)
+
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+
+		// First the backoff, then the rest of the second the limiter needs
+		// to hand out another token.
+		for i := 0; i < 2; i++ {
+			clock.BlockUntil(1)
+			clock.AdvanceToNext()
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		expected := []time.Duration{100 * time.Millisecond, 900 * time.Millisecond}
+		if got := clock.Durations(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected waits %v, got %v", expected, got)
+		}
+		srv.AssertAttempts(t, 2)
+	})
+
+	t.Run("One limiter per host", func(t *testing.T) {
+		first := retryhttptest.NewServer()
+		defer first.Close()
+		second := retryhttptest.NewServer()
+		defer second.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		var hosts []string
+		client := retryhttp.New(
+			retryhttp.WithClock(clock),
+			retryhttp.WithKeyedRateLimiter(retryhttp.HostKey, func(key string) retryhttp.Limiter {
+				hosts = append(hosts, key)
+				return retryhttp.NewTokenBucket(1, 1, clock)
+			}),
+		)
+
+		for _, url := range []string{first.URL, second.URL} {
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			resp.Body.Close()
+		}
+		if clock.Pending() != 0 || len(clock.Durations()) != 0 {
+			t.Fatal("expected each host to have its own token")
+		}
+		if len(hosts) != 2 {
+			t.Fatalf("expected 2 limiters, got %v", hosts)
+		}
+
+		// A second request to the first host has to wait for its bucket.
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(first.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+		clock.BlockUntil(1)
+		clock.AdvanceToNext()
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(hosts) != 2 {
+			t.Fatalf("expected limiters to be reused, got %v", hosts)
+		}
+	})
+
+	t.Run("Concurrent first requests create a single limiter", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		var created atomic.Int32
+		client := retryhttp.New(
+			retryhttp.WithKeyedRateLimiter(retryhttp.HostKey, func(string) retryhttp.Limiter {
+				created.Add(1)
+				// A slow factory widens the window for duplicates.
+				time.Sleep(10 * time.Millisecond)
+				return retryhttp.NewTokenBucket(1000, 1000, nil)
+			}),
+		)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(srv.URL)
+				if err != nil {
+					t.Errorf("expected no error, got: %v", err)
+					return
+				}
+				resp.Body.Close()
+			}()
+		}
+		wg.Wait()
+		if got := created.Load(); got != 1 {
+			t.Fatalf("expected a single limiter, got %d", got)
+		}
+	})
+
+	t.Run("Limiter wait respects the request context", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		limiter := retryhttp.NewTokenBucket(1, 1, clock)
+		limiter.Wait(context.Background())
+
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithClock(clock),
+			retryhttp.WithRateLimiter(limiter),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.Do(req)
+			errc <- err
+		}()
+		clock.BlockUntil(1)
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+		srv.AssertAttempts(t, 0)
+	})
+}
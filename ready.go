@@ -0,0 +1,228 @@
+package retryhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrNotReady is wrapped by the error WaitUntilReady returns when the
+// service did not become ready in time.
+var ErrNotReady = errors.New("service not ready")
+
+// NotReadyError describes why WaitUntilReady gave up.
+type NotReadyError struct {
+	// URL is the URL that was probed.
+	URL string
+
+	// Attempts is the number of probes made.
+	Attempts int
+
+	// Failures holds the last few failed probes, oldest first.
+	Failures []error
+
+	// Err is the reason for giving up, such as the context error.
+	Err error
+}
+
+func (e *NotReadyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s after %d attempts: %v", ErrNotReady, e.URL, e.Attempts, e.Err)
+	if len(e.Failures) > 0 {
+		b.WriteString("; last failures:")
+		for _, f := range e.Failures {
+			b.WriteString("\n\t")
+			b.WriteString(f.Error())
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns ErrNotReady and the reason for giving up.
+func (e *NotReadyError) Unwrap() []error {
+	return []error{ErrNotReady, e.Err}
+}
+
+// ReadyCheck decides from a probe response whether the service is ready. It
+// returns nil if it is, or an error describing why not. It may read the
+// response body, but must not close it.
+type ReadyCheck func(resp *http.Response) error
+
+// ReadyStatus returns a ReadyCheck that passes when the response status is
+// one of codes.
+func ReadyStatus(codes ...int) ReadyCheck {
+	return func(resp *http.Response) error {
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// ReadyJSONField returns a ReadyCheck that passes when the response has a
+// 2xx status and a JSON body in which the field at path equals want. The
+// path is made of object keys separated by dots, such as "checks.database".
+// Values are compared after encoding want to JSON and back, so 1 and 1.0
+// are equal.
+func ReadyJSONField(path string, want any) ReadyCheck {
+	var normalized any
+	if data, err := json.Marshal(want); err == nil {
+		json.Unmarshal(data, &normalized)
+	}
+
+	return func(resp *http.Response) error {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		var body any
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+
+		value := body
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("field %q not found", path)
+			}
+			if value, ok = obj[key]; !ok {
+				return fmt.Errorf("field %q not found", path)
+			}
+		}
+		if !reflect.DeepEqual(value, normalized) {
+			return fmt.Errorf("field %q is %v, want %v", path, value, want)
+		}
+		return nil
+	}
+}
+
+// ReadyOption configures a single call to WaitUntilReady.
+type ReadyOption func(*readyConfig)
+
+// readyConfig holds the settings of a call to WaitUntilReady.
+type readyConfig struct {
+	check       ReadyCheck
+	successes   int
+	timeout     time.Duration
+	maxFailures int
+	err         error
+}
+
+// ReadyWhen sets the readiness predicate. The default is
+// ReadyStatus(http.StatusOK).
+func ReadyWhen(check ReadyCheck) ReadyOption {
+	return func(rc *readyConfig) {
+		if check == nil {
+			rc.err = invalidOption("ReadyWhen", "check must not be nil")
+			return
+		}
+		rc.check = check
+	}
+}
+
+// ReadyConsecutiveSuccesses requires the check to pass n times in a row. The
+// default is once.
+func ReadyConsecutiveSuccesses(n int) ReadyOption {
+	return func(rc *readyConfig) {
+		if n <= 0 {
+			rc.err = invalidOption("ReadyConsecutiveSuccesses", "successes must be at least 1, got %d", n)
+			return
+		}
+		rc.successes = n
+	}
+}
+
+// ReadyTimeout gives up once waiting for another probe would go past d
+// since the first one. Zero, the default, means no limit other than the
+// context.
+func ReadyTimeout(d time.Duration) ReadyOption {
+	return func(rc *readyConfig) {
+		if d < 0 {
+			rc.err = invalidOption("ReadyTimeout", "timeout must not be negative, got %s", d)
+			return
+		}
+		rc.timeout = d
+	}
+}
+
+// WaitUntilReady probes url with GET requests until the readiness check
+// passes, as many times in a row as required. It is meant to gate work on a
+// service coming up, such as in integration tests or init containers.
+//
+// Each probe is a single attempt: failed probes are followed by the backoff
+// of the client, which starts over after a successful one. When the context
+// is done or the timeout is reached, it returns a *NotReadyError listing the
+// last few failures. An invalid option is reported as an error wrapping
+// ErrInvalidOption, before any probe.
+func (c *Client) WaitUntilReady(ctx context.Context, url string, opts ...ReadyOption) error {
+	rc := readyConfig{check: ReadyStatus(http.StatusOK), successes: 1, maxFailures: 5}
+	for _, opt := range opts {
+		opt(&rc)
+	}
+	if rc.err != nil {
+		return rc.err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	probe := c.With(WithMaxRetries(0), WithCondition(func(*http.Response, error) bool { return false }))
+	cfg := probe.cfg.Load()
+	start := cfg.clock.Now()
+	backoff := cfg.initialBackoff
+
+	var failures []error
+	giveUp := func(attempts int, err error) error {
+		return &NotReadyError{URL: url, Attempts: attempts, Failures: failures, Err: err}
+	}
+
+	successes := 0
+	for attempt := 1; ; attempt++ {
+		err := probeReady(probe, req, rc.check)
+		if ctx.Err() != nil {
+			return giveUp(attempt-1, ctx.Err())
+		}
+
+		wait := backoff
+		if err == nil {
+			if successes++; successes >= rc.successes {
+				return nil
+			}
+			backoff = cfg.initialBackoff
+			wait = backoff
+		} else {
+			successes = 0
+			failures = append(failures, fmt.Errorf("attempt %d: %w", attempt, err))
+			if len(failures) > rc.maxFailures {
+				failures = failures[1:]
+			}
+			backoff = cfg.nextBackoff(backoff)
+		}
+
+		if rc.timeout > 0 && cfg.clock.Now().Sub(start)+wait > rc.timeout {
+			return giveUp(attempt, fmt.Errorf("timed out after %s", rc.timeout))
+		}
+		if err := cfg.sleep(ctx, wait); err != nil {
+			return giveUp(attempt, err)
+		}
+	}
+}
+
+// probeReady makes a single probe and runs check against its response.
+func probeReady(probe *Client, req *http.Request, check ReadyCheck) error {
+	resp, err := probe.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return check(resp)
+}
@@ -0,0 +1,96 @@
+package retryhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WaitUntilReady(t *testing.T) {
+	t.Run("Waits for consecutive successes", func(t *testing.T) {
+		srv := retryhttptest.NewServer(
+			retryhttptest.Step{Status: http.StatusServiceUnavailable},
+			retryhttptest.Step{Reset: true},
+			retryhttptest.Step{Body: `{"status":"starting"}`},
+			retryhttptest.Step{Body: `{"status":"ok","checks":{"db":1}}`},
+			retryhttptest.Step{Status: http.StatusInternalServerError},
+			retryhttptest.Step{Body: `{"status":"ok","checks":{"db":1}}`},
+			retryhttptest.Step{Body: `{"status":"ok","checks":{"db":1}}`},
+		)
+		defer srv.Close()
+
+		client := retryhttp.New(retryhttp.WithInitialBackoff(time.Millisecond))
+		err := client.WaitUntilReady(context.Background(), srv.URL,
+			retryhttp.ReadyWhen(retryhttp.ReadyJSONField("checks.db", 1)),
+			retryhttp.ReadyConsecutiveSuccesses(2),
+		)
+		if err != nil {
+			t.Fatalf("expected the service to become ready, got: %v", err)
+		}
+		srv.AssertAttempts(t, 7)
+	})
+
+	t.Run("Timeout lists the last failures", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Repeat(100, retryhttptest.Step{Status: http.StatusServiceUnavailable})...)
+		defer srv.Close()
+
+		clock := retryhttptest.NewFakeClock(time.Now())
+		client := retryhttp.New(retryhttp.WithClock(clock), retryhttp.WithBackoffStrategy(retryhttp.BackoffConstant))
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- client.WaitUntilReady(context.Background(), srv.URL, retryhttp.ReadyTimeout(time.Second))
+		}()
+		for i := 0; i < 10; i++ {
+			clock.BlockUntil(1)
+			clock.AdvanceToNext()
+		}
+		err := <-errc
+
+		var notReady *retryhttp.NotReadyError
+		if !errors.As(err, &notReady) || !errors.Is(err, retryhttp.ErrNotReady) {
+			t.Fatalf("expected a NotReadyError, got: %v", err)
+		}
+		if notReady.Attempts != 11 || len(notReady.Failures) != 5 {
+			t.Fatalf("expected 11 attempts and 5 failures, got %d and %d", notReady.Attempts, len(notReady.Failures))
+		}
+		if msg := err.Error(); !strings.Contains(msg, "attempt 11: unexpected status 503") || strings.Contains(msg, "attempt 6:") {
+			t.Fatalf("expected the last five failures in the error, got: %v", msg)
+		}
+	})
+
+	t.Run("Context cancellation", func(t *testing.T) {
+		srv := retryhttptest.NewServer(retryhttptest.Step{Status: http.StatusServiceUnavailable})
+		defer srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := retryhttp.New(retryhttp.WithInitialBackoff(time.Hour), retryhttp.WithMaxBackoff(time.Hour)).WaitUntilReady(ctx, srv.URL)
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "attempt 1: unexpected status 503") {
+			t.Fatalf("expected the deadline and the failure in the error, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		srv := retryhttptest.NewServer()
+		defer srv.Close()
+
+		for name, opt := range map[string]retryhttp.ReadyOption{
+			"nil check":        retryhttp.ReadyWhen(nil),
+			"zero successes":   retryhttp.ReadyConsecutiveSuccesses(0),
+			"negative timeout": retryhttp.ReadyTimeout(-time.Second),
+		} {
+			err := retryhttp.New().WaitUntilReady(context.Background(), srv.URL, opt)
+			if !errors.Is(err, retryhttp.ErrInvalidOption) {
+				t.Fatalf("%s: expected ErrInvalidOption, got: %v", name, err)
+			}
+		}
+		srv.AssertAttempts(t, 0)
+	})
+}
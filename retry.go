@@ -2,14 +2,20 @@ package retryhttp
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// retryableclient is the part of the API of Client that *http.Client has
+// too, which makes Client a drop-in replacement.
 type retryableclient interface {
 	Do(req *http.Request) (*http.Response, error)
 	CloseIdleConnections()
@@ -19,69 +25,233 @@ type retryableclient interface {
 	PostForm(url string, data url.Values) (resp *http.Response, err error)
 }
 
+// RetryableClient is the set of methods of Client to send requests. Code
+// that depends on it instead of on *Client can be tested with a mock.
+type RetryableClient interface {
+	Do(req *http.Request) (*http.Response, error)
+	CloseIdleConnections()
+	Get(url string) (resp *http.Response, err error)
+	GetContext(ctx context.Context, url string) (resp *http.Response, err error)
+	Head(url string) (resp *http.Response, err error)
+	HeadContext(ctx context.Context, url string) (resp *http.Response, err error)
+	Post(url, contentType string, body io.Reader) (resp *http.Response, err error)
+	PostContext(ctx context.Context, url, contentType string, body io.Reader) (resp *http.Response, err error)
+	PostForm(url string, data url.Values) (resp *http.Response, err error)
+	PostFormContext(ctx context.Context, url string, data url.Values) (resp *http.Response, err error)
+	Put(url, contentType string, body io.Reader) (resp *http.Response, err error)
+	PutContext(ctx context.Context, url, contentType string, body io.Reader) (resp *http.Response, err error)
+	Patch(url, contentType string, body io.Reader) (resp *http.Response, err error)
+	PatchContext(ctx context.Context, url, contentType string, body io.Reader) (resp *http.Response, err error)
+	Delete(url string) (resp *http.Response, err error)
+	DeleteContext(ctx context.Context, url string) (resp *http.Response, err error)
+	Options(url string) (resp *http.Response, err error)
+	OptionsContext(ctx context.Context, url string) (resp *http.Response, err error)
+}
+
 var (
 	_ retryableclient = (*Client)(nil)
 	_ retryableclient = (*http.Client)(nil)
+	_ RetryableClient = (*Client)(nil)
 )
 
 // ErrMaxRetriesExceeded is returned when the maximum number of retries is exceeded.
 var ErrMaxRetriesExceeded = errors.New("max retries exceeded")
 
+// ErrMaxElapsedTimeExceeded is returned when waiting for another attempt would
+// exceed the maximum elapsed time.
+var ErrMaxElapsedTimeExceeded = errors.New("max elapsed time exceeded")
+
 // RetryConditionFunc defines when a request should be retried.
 type RetryConditionFunc func(resp *http.Response, err error) bool
 
-// Client is our custom HTTP client with retry support.
+// Client is our custom HTTP client with retry support. It is safe for
+// concurrent use, and its settings can be changed at any time with Update.
 type Client struct {
+	mu  sync.Mutex // serializes Update calls
+	cfg atomic.Pointer[config]
+}
+
+// config is an immutable snapshot of a client's settings. Options only ever
+// modify a fresh copy, before it is published.
+type config struct {
 	client            *http.Client
 	maxRetries        int
 	retryCondition    RetryConditionFunc
 	initialBackoff    time.Duration
 	backoffMultiplier float64
 	maxBackoff        time.Duration
+	maxBackoffSet     bool // whether maxBackoff was set, rather than defaulted
+	backoffStrategy   BackoffStrategy
+	retryableMethods  map[string]bool
+	respectRetryAfter bool
+	maxRetryAfter     time.Duration
+	maxElapsedTime    time.Duration
+	limiter           func(*http.Request) Limiter
+	quota             *quotaTracker
+	cooldown          *cooldownRegistry
+	bulkhead          *bulkhead
+	adaptive          *adaptiveLimiter
+	failover          *failover
+	rotation          *addressRotation
+	unsafeRetry       UnsafeRetryMode
+	tokens            *tokenCache
+	signer            Signer
+	endpointFailures  int
+	endpointCooldown  time.Duration
+	onAttempt         func(AttemptInfo)
+	middleware        []Middleware
+	attemptMiddleware []Middleware
+	send              Doer // the retry loop, wrapped by middleware
+	sendAttempt       Doer // client, wrapped by attemptMiddleware
+	clock             Clock
 }
 
-// Option defines a function type to configure Client.
-type Option func(*Client)
+// ErrInvalidOption is wrapped by every error reported by an invalid Option.
+var ErrInvalidOption = errors.New("invalid option")
+
+// Option defines a function type to configure Client. An option returns an
+// error if the value it was given is invalid.
+type Option func(*config) error
+
+// invalidOption builds the error reported by the option called name.
+func invalidOption(name, format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalidOption, name, fmt.Sprintf(format, args...))
+}
 
 // WithClient sets the underlying HTTP client.
 func WithClient(c *http.Client) Option {
-	return func(cli *Client) {
-		cli.client = c
+	return func(cfg *config) error {
+		if c == nil {
+			return invalidOption("WithClient", "client must not be nil")
+		}
+		cfg.client = c
+		return nil
 	}
 }
 
 // WithMaxRetries sets the maximum number of retry attempts.
 func WithMaxRetries(retries int) Option {
-	return func(cli *Client) {
-		cli.maxRetries = retries
+	return func(cfg *config) error {
+		if retries < 0 {
+			return invalidOption("WithMaxRetries", "retries must not be negative, got %d", retries)
+		}
+		cfg.maxRetries = retries
+		return nil
 	}
 }
 
 // WithCondition sets the retry condition function.
 func WithCondition(cond RetryConditionFunc) Option {
-	return func(cli *Client) {
-		cli.retryCondition = cond
+	return func(cfg *config) error {
+		if cond == nil {
+			return invalidOption("WithCondition", "condition must not be nil")
+		}
+		cfg.retryCondition = cond
+		return nil
 	}
 }
 
 // WithInitialBackoff sets the initial backoff duration.
 func WithInitialBackoff(d time.Duration) Option {
-	return func(cli *Client) {
-		cli.initialBackoff = d
+	return func(cfg *config) error {
+		if d < 0 {
+			return invalidOption("WithInitialBackoff", "duration must not be negative, got %s", d)
+		}
+		cfg.initialBackoff = d
+		return nil
 	}
 }
 
-// WithBackoffMultiplier sets the backoff multiplier.
+// WithBackoffMultiplier sets the backoff multiplier. It must be at least 1.
 func WithBackoffMultiplier(m float64) Option {
-	return func(cli *Client) {
-		cli.backoffMultiplier = m
+	return func(cfg *config) error {
+		if m < 1 {
+			return invalidOption("WithBackoffMultiplier", "multiplier must be at least 1, got %g", m)
+		}
+		cfg.backoffMultiplier = m
+		return nil
 	}
 }
 
-// WithMaxBackoff sets the maximum backoff duration.
+// WithMaxBackoff sets the maximum backoff duration. It must not be smaller
+// than the initial backoff. The default is two seconds, or the initial
+// backoff if it is longer.
 func WithMaxBackoff(d time.Duration) Option {
-	return func(cli *Client) {
-		cli.maxBackoff = d
+	return func(cfg *config) error {
+		if d < 0 {
+			return invalidOption("WithMaxBackoff", "duration must not be negative, got %s", d)
+		}
+		cfg.maxBackoff = d
+		cfg.maxBackoffSet = true
+		return nil
+	}
+}
+
+// WithBackoffStrategy sets how the wait between attempts grows. The
+// default is BackoffExponential.
+func WithBackoffStrategy(s BackoffStrategy) Option {
+	return func(cfg *config) error {
+		if !s.valid() {
+			return invalidOption("WithBackoffStrategy", "unknown strategy %q", s)
+		}
+		cfg.backoffStrategy = s
+		return nil
+	}
+}
+
+// WithRetryableMethods restricts retries to requests using one of the given
+// methods. Requests using any other method are attempted only once. By
+// default, every method is retried.
+func WithRetryableMethods(methods ...string) Option {
+	return func(cfg *config) error {
+		set := make(map[string]bool, len(methods))
+		for _, m := range methods {
+			if !validMethod(m) {
+				return invalidOption("WithRetryableMethods", "%q is not a valid HTTP method", m)
+			}
+			set[strings.ToUpper(m)] = true
+		}
+		cfg.retryableMethods = set
+		return nil
+	}
+}
+
+// WithRetryAfter makes the client honor the Retry-After header of retryable
+// responses, waiting as long as the server asks instead of the regular
+// backoff. Waits longer than max are capped to max, unless max is zero.
+func WithRetryAfter(max time.Duration) Option {
+	return func(cfg *config) error {
+		if max < 0 {
+			return invalidOption("WithRetryAfter", "maximum must not be negative, got %s", max)
+		}
+		cfg.respectRetryAfter = true
+		cfg.maxRetryAfter = max
+		return nil
+	}
+}
+
+// WithMaxElapsedTime limits the total time spent on a request, retries and
+// waits included. Once waiting for another attempt would go past d, Do gives
+// up. Zero means no limit.
+func WithMaxElapsedTime(d time.Duration) Option {
+	return func(cfg *config) error {
+		if d < 0 {
+			return invalidOption("WithMaxElapsedTime", "duration must not be negative, got %s", d)
+		}
+		cfg.maxElapsedTime = d
+		return nil
+	}
+}
+
+// WithClock sets the clock used for backoff waits. It is mostly useful in
+// tests, where a fake clock removes the need for real sleeps.
+func WithClock(clock Clock) Option {
+	return func(cfg *config) error {
+		if clock == nil {
+			return invalidOption("WithClock", "clock must not be nil")
+		}
+		cfg.clock = clock
+		return nil
 	}
 }
 
@@ -99,26 +269,136 @@ func DefaultRetryCondition(resp *http.Response, err error) bool {
 	return false
 }
 
-// New creates a new Client using the provided options.
+// New creates a new Client using the provided options. It panics if any
+// option is invalid; use NewE to handle the error instead.
 func New(opts ...Option) *Client {
-	cli := &Client{
+	cli, err := NewE(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return cli
+}
+
+// defaultMaxBackoff is the maximum backoff when none is set, unless the
+// initial backoff is longer.
+const defaultMaxBackoff = 2 * time.Second
+
+// NewE creates a new Client using the provided options. Every invalid option
+// is reported, joined into a single error.
+func NewE(opts ...Option) (*Client, error) {
+	cfg := &config{
 		client:            http.DefaultClient,
 		maxRetries:        5,
 		retryCondition:    DefaultRetryCondition,
 		initialBackoff:    100 * time.Millisecond,
 		backoffMultiplier: 2,
-		maxBackoff:        2 * time.Second,
+		maxBackoff:        defaultMaxBackoff,
+		backoffStrategy:   BackoffExponential,
+		endpointFailures:  1,
+		endpointCooldown:  30 * time.Second,
+		clock:             realClock{},
+	}
+	if err := cfg.apply(opts); err != nil {
+		return nil, err
 	}
+
+	cli := &Client{}
+	cli.cfg.Store(cfg)
+	return cli, nil
+}
+
+// Update atomically replaces the client's settings with a copy of the
+// current ones, modified by opts. Requests already in flight finish with the
+// settings they started with; requests started afterwards use the new ones.
+// If any option is invalid, nothing changes and the error is returned.
+func (c *Client) Update(opts ...Option) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := *c.cfg.Load()
+	if err := next.apply(opts); err != nil {
+		return err
+	}
+	c.cfg.Store(&next)
+	return nil
+}
+
+// With returns a new client derived from c: it starts from a copy of c's
+// current settings and applies opts on top. It panics if any option is
+// invalid; use WithE to handle the error instead.
+//
+// The derived client shares every component that holds state or resources
+// with c:
+//   - the underlying *http.Client, with its transport and connection pool
+//   - the clock and the retry condition
+//   - rate limiters, including the per-key limiters created so far
+//   - the quota advertised by servers through rate limit headers
+//   - host cooldowns
+//   - bulkheads, with their in-flight and queued attempts
+//   - the send rates learned by adaptive mode
+//   - endpoints and their health
+//   - the transports and connections of each address rotated through
+//   - the current token of the token source
+//   - middlewares, after which opts may add more
+//
+// Plain settings, such as the number of retries or the backoff durations, are
+// copied, so changing them on either client, including through Update, does
+// not affect the other.
+func (c *Client) With(opts ...Option) *Client {
+	derived, err := c.WithE(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return derived
+}
+
+// WithE is like With but returns an error instead of panicking if any
+// option is invalid.
+func (c *Client) WithE(opts ...Option) (*Client, error) {
+	next := *c.cfg.Load()
+	if err := next.apply(opts); err != nil {
+		return nil, err
+	}
+
+	derived := &Client{}
+	derived.cfg.Store(&next)
+	return derived, nil
+}
+
+// apply runs every option against cfg and validates the result.
+func (cfg *config) apply(opts []Option) error {
+	var errs []error
 	for _, opt := range opts {
-		opt(cli)
+		if err := opt(cfg); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return cli
+	if !cfg.maxBackoffSet {
+		cfg.maxBackoff = max(defaultMaxBackoff, cfg.initialBackoff)
+	}
+	if cfg.maxBackoff < cfg.initialBackoff {
+		errs = append(errs, fmt.Errorf("%w: maximum backoff (%s) must not be smaller than initial backoff (%s)", ErrInvalidOption, cfg.maxBackoff, cfg.initialBackoff))
+	}
+	cfg.buildMiddleware()
+	return errors.Join(errs...)
 }
 
 // Do sends an HTTP request with retry logic. It is a drop-in replacement for http.Client.Do.
 // It buffers the request body (if any) so that it can be replayed on retries, while leaving response
 // bodies untouched for streaming. The response body is only closed if a retry is needed.
+//
+// The request goes through the middlewares added with WithMiddleware, then
+// the retry loop, which on every attempt picks the endpoint, sets the token,
+// waits on the rate limiters, the adaptive limiter, the server quota and the
+// host cooldown, signs the request, picks the address, takes a bulkhead
+// slot, and sends it through the middlewares added with
+// WithAttemptMiddleware to the http.Client.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.cfg.Load().send.Do(req)
+}
+
+// do runs the retry loop for req.
+func (cfg *config) do(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
 	var resp *http.Response
 	var err error
@@ -137,32 +417,191 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 	}
 
-	backoff := c.initialBackoff
+	start := cfg.clock.Now()
+	backoff := cfg.initialBackoff
+	var endpoint *endpointState
+	var rotationOffset uint64
+	var sent int
+	var refreshed bool
+	var fresh bool
 
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+	for attempt := 0; attempt <= cfg.maxRetries; attempt++ {
 		// Check for context cancellation.
 		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
 
+		// Send the attempt to the next endpoint, if there are several.
+		areq := req
+		if cfg.failover != nil {
+			endpoint = cfg.failover.pick(endpoint, cfg.clock.Now())
+			areq = endpoint.rewrite(req)
+		}
+
+		// Authenticate the attempt with the current token.
+		var token string
+		if cfg.tokens != nil {
+			var tokenErr error
+			if token, tokenErr = cfg.tokens.current(ctx, ""); tokenErr != nil {
+				return nil, tokenErr
+			}
+			if areq == req {
+				areq = req.Clone(ctx)
+			}
+			areq.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		// Wait for the rate limiter, so retries count against the quota too.
+		if cfg.limiter != nil {
+			if err := cfg.limiter(areq).Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		// Hold back to the send rate adaptive mode allows.
+		if cfg.adaptive != nil {
+			if err := cfg.adaptive.wait(ctx, cfg, areq.URL.Host); err != nil {
+				return nil, err
+			}
+		}
+
+		// Hold back while the quota advertised by the server is used up.
+		if cfg.quota != nil {
+			if err := cfg.quota.wait(ctx, cfg, areq.URL.Host); err != nil {
+				return nil, err
+			}
+		}
+
+		// Hold back while the host is cooling down after pushing back.
+		if cfg.cooldown != nil {
+			if err := cfg.cooldown.wait(ctx, cfg, areq.URL.Host); err != nil {
+				return nil, err
+			}
+		}
+
 		// For retries, reset the request body if available.
-		if attempt > 0 && req.Body != nil && req.GetBody != nil {
-			newBody, getErr := req.GetBody()
+		if sent > 0 && areq.Body != nil && areq.GetBody != nil {
+			newBody, getErr := areq.GetBody()
 			if getErr != nil {
 				return nil, getErr
 			}
-			req.Body = newBody
+			areq.Body = newBody
+		}
+
+		// Sign every attempt afresh, with the whole body.
+		if cfg.signer != nil {
+			if areq == req {
+				areq = req.Clone(ctx)
+			}
+			var body []byte
+			if areq.Body != nil && areq.GetBody != nil {
+				rc, getErr := areq.GetBody()
+				if getErr != nil {
+					return nil, getErr
+				}
+				body, getErr = io.ReadAll(rc)
+				rc.Close()
+				if getErr != nil {
+					return nil, getErr
+				}
+				areq.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			if err := cfg.signer.Sign(areq, body); err != nil {
+				return nil, err
+			}
+		}
+
+		// Dial a different address of the host on every attempt.
+		rt := route{client: cfg.client}
+		if cfg.rotation != nil {
+			if sent == 0 {
+				rotationOffset = cfg.rotation.offset(areq.URL.Host)
+			}
+			var routeErr error
+			rt, routeErr = cfg.rotation.route(ctx, cfg.client, areq, rotationOffset+uint64(sent))
+			if routeErr != nil {
+				return nil, routeErr
+			}
+		}
+		if fresh && rt.transport == nil {
+			rt.client = cfg.freshClient()
+		}
+		fresh = false
+
+		// Take a slot in the host's bulkhead for as long as the attempt lasts.
+		var release func()
+		if cfg.bulkhead != nil {
+			var acquireErr error
+			release, acquireErr = cfg.bulkhead.acquire(ctx, cfg, areq.URL.Host)
+			if acquireErr != nil {
+				return nil, acquireErr
+			}
 		}
 
-		resp, err = c.client.Do(req)
+		resp, err = cfg.attempt(rt.client).Do(areq)
+		sent++
+		retry := cfg.retryCondition(resp, err)
+		if release != nil {
+			releaseOnClose(resp, release)
+		}
+		if cfg.quota != nil {
+			cfg.quota.observe(areq.URL.Host, resp, cfg.clock.Now())
+		}
+		var pushedBack bool
+		if cfg.cooldown != nil {
+			pushedBack = cfg.cooldown.observe(areq.URL.Host, resp, cfg.clock.Now())
+		}
+		if cfg.adaptive != nil {
+			cfg.adaptive.observe(cfg, areq.URL.Host, resp, retry)
+		}
+		if cfg.failover != nil {
+			cfg.failover.observe(cfg, endpoint, resp, err)
+		}
+		if cfg.onAttempt != nil {
+			info := AttemptInfo{Attempt: sent - 1, Endpoint: areq.URL.Scheme + "://" + areq.URL.Host, Address: rt.address, Err: err}
+			if resp != nil {
+				info.StatusCode = resp.StatusCode
+			}
+			cfg.onAttempt(info)
+		}
 
 		// Check for cancellation after the request.
 		if ctx.Err() != nil {
+			if resp != nil && resp.Body != nil {
+				resp.Body.Close()
+			}
 			return nil, ctx.Err()
 		}
 
+		// Refresh a rejected token once and send the request again right
+		// away, without counting it as a retry. A second rejection is final.
+		if cfg.tokens != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			if refreshed {
+				return resp, err
+			}
+			refreshed = true
+			resp.Body.Close()
+			if _, err := cfg.tokens.current(ctx, token); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+
+		// A retry would only fail with ErrHostCoolingDown, so the pushback is
+		// the better answer.
+		if pushedBack && cfg.cooldown.mode == CooldownFailFast {
+			return resp, err
+		}
+
 		// Return immediately if retry is not required.
-		if !c.retryCondition(resp, err) {
+		if !retry || !cfg.methodRetryable(req.Method) {
+			return resp, err
+		}
+		if ok, unknownErr := cfg.unsafeRetryAllowed(req, err); !ok {
+			if unknownErr != nil {
+				return nil, unknownErr
+			}
 			return resp, err
 		}
 
@@ -171,16 +610,45 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 			resp.Body.Close()
 		}
 
-		// Wait for the backoff period or until context cancellation.
-		select {
-		case <-time.After(backoff):
-			backoff = time.Duration(float64(backoff) * c.backoffMultiplier)
-			if backoff > c.maxBackoff {
-				backoff = c.maxBackoff
+		// Do not reuse connections to an address that just failed. After a
+		// connection-level failure, the other idle connections to the
+		// server are likely dead too, so force a fresh one.
+		if IsConnectionError(err) {
+			cfg.closeOwnIdleConnections()
+			fresh = true
+		} else if rt.transport != nil {
+			rt.transport.CloseIdleConnections()
+		}
+
+		// There is no point in waiting after the last attempt.
+		if attempt == cfg.maxRetries {
+			break
+		}
+
+		// Prefer the wait requested by the server, if allowed.
+		wait := backoff
+		if cfg.respectRetryAfter {
+			if d, ok := retryAfter(resp, cfg.clock.Now()); ok {
+				wait = d
+				if cfg.maxRetryAfter > 0 && wait > cfg.maxRetryAfter {
+					wait = cfg.maxRetryAfter
+				}
 			}
-		case <-ctx.Done():
-			return nil, ctx.Err()
 		}
+
+		// Give up if the wait would go past the elapsed time limit.
+		if cfg.maxElapsedTime > 0 && cfg.clock.Now().Sub(start)+wait > cfg.maxElapsedTime {
+			if err == nil {
+				err = ErrMaxElapsedTimeExceeded
+			}
+			return resp, err
+		}
+
+		// Wait for the backoff period or until context cancellation.
+		if err := cfg.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		backoff = cfg.nextBackoff(backoff)
 	}
 
 	if err == nil {
@@ -189,58 +657,194 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
+// methodRetryable reports whether requests using method may be retried.
+func (cfg *config) methodRetryable(method string) bool {
+	if cfg.retryableMethods == nil {
+		return true
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+	return cfg.retryableMethods[method]
+}
+
+// sleep waits for d on the client's clock, returning early with the context
+// error if ctx is done first.
+func (cfg *config) sleep(ctx context.Context, d time.Duration) error {
+	timer := cfg.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // transport returns the underlying RoundTripper used by the client.
-// If c.client.Transport is nil, it returns http.DefaultTransport.
-func (c *Client) transport() http.RoundTripper {
-	if c.client.Transport != nil {
-		return c.client.Transport
+// If the HTTP client's Transport is nil, it returns http.DefaultTransport.
+func (cfg *config) transport() http.RoundTripper {
+	if tr := cfg.client.Transport; tr != nil {
+		return tr
 	}
 	return http.DefaultTransport
 }
 
 // CloseIdleConnections closes any connections on the underlying Transport
-// which are sitting idle in a "keep-alive" state. If the Transport does not
+// which are sitting idle in a "keep-alive" state, including those of every
+// address rotated through with WithAddressRotation. If the Transport does not
 // implement CloseIdleConnections, this method does nothing.
 func (c *Client) CloseIdleConnections() {
+	c.cfg.Load().closeIdleConnections()
+}
+
+func (cfg *config) closeIdleConnections() {
 	type closeIdler interface {
 		CloseIdleConnections()
 	}
-	if tr, ok := c.transport().(closeIdler); ok {
+	if tr, ok := cfg.transport().(closeIdler); ok {
 		tr.CloseIdleConnections()
 	}
+	if cfg.rotation != nil {
+		cfg.rotation.closeIdleConnections()
+	}
+}
+
+// closeOwnIdleConnections is like closeIdleConnections, but leaves alone
+// http.DefaultTransport, whose pool every other user of it in the process
+// shares. freshClient takes care of that case instead.
+func (cfg *config) closeOwnIdleConnections() {
+	if cfg.transport() == http.DefaultTransport {
+		if cfg.rotation != nil {
+			cfg.rotation.closeIdleConnections()
+		}
+		return
+	}
+	cfg.closeIdleConnections()
+}
+
+// noReuseTransport is a copy of http.DefaultTransport that makes a new
+// connection for every request, or nil if http.DefaultTransport is not an
+// *http.Transport.
+var noReuseTransport = sync.OnceValue(func() *http.Transport {
+	tr, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil
+	}
+	tr = tr.Clone()
+	tr.DisableKeepAlives = true
+	return tr
+})
+
+// freshClient returns the client to send an attempt with after a
+// connection-level failure. When the transport is http.DefaultTransport,
+// whose idle connections are left alone, it is a copy of the client that
+// makes a new connection instead of picking one of them.
+func (cfg *config) freshClient() *http.Client {
+	if cfg.transport() != http.DefaultTransport {
+		return cfg.client
+	}
+	tr := noReuseTransport()
+	if tr == nil {
+		return cfg.client
+	}
+	client := *cfg.client
+	client.Transport = tr
+	return &client
 }
 
 // Get issues a GET request to the specified URL. It is a drop-in replacement for http.Client.Get.
 func (c *Client) Get(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	return c.Do(req)
+	return c.GetContext(context.Background(), url)
+}
+
+// GetContext is like Get, with a context for the request.
+func (c *Client) GetContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.send(ctx, http.MethodGet, url, "", nil)
 }
 
 // Head issues a HEAD request to the specified URL. It is a drop-in replacement for http.Client.Head.
 func (c *Client) Head(url string) (*http.Response, error) {
-	req, err := http.NewRequest("HEAD", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	return c.Do(req)
+	return c.HeadContext(context.Background(), url)
+}
+
+// HeadContext is like Head, with a context for the request.
+func (c *Client) HeadContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.send(ctx, http.MethodHead, url, "", nil)
 }
 
 // Post issues a POST request to the specified URL with the given content type and body.
 // It is a drop-in replacement for http.Client.Post.
 func (c *Client) Post(url, contentType string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", contentType)
-	return c.Do(req)
+	return c.PostContext(context.Background(), url, contentType, body)
+}
+
+// PostContext is like Post, with a context for the request.
+func (c *Client) PostContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.send(ctx, http.MethodPost, url, contentType, body)
 }
 
 // PostForm issues a POST request with form data (URL-encoded) to the specified URL.
 // It is a drop-in replacement for http.Client.PostForm.
 func (c *Client) PostForm(urlStr string, data url.Values) (*http.Response, error) {
-	return c.Post(urlStr, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+	return c.PostFormContext(context.Background(), urlStr, data)
+}
+
+// PostFormContext is like PostForm, with a context for the request.
+func (c *Client) PostFormContext(ctx context.Context, urlStr string, data url.Values) (*http.Response, error) {
+	return c.PostContext(ctx, urlStr, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+// Put issues a PUT request to the specified URL with the given content type and body.
+func (c *Client) Put(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.PutContext(context.Background(), url, contentType, body)
+}
+
+// PutContext is like Put, with a context for the request.
+func (c *Client) PutContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.send(ctx, http.MethodPut, url, contentType, body)
+}
+
+// Patch issues a PATCH request to the specified URL with the given content type and body.
+func (c *Client) Patch(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.PatchContext(context.Background(), url, contentType, body)
+}
+
+// PatchContext is like Patch, with a context for the request.
+func (c *Client) PatchContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.send(ctx, http.MethodPatch, url, contentType, body)
+}
+
+// Delete issues a DELETE request to the specified URL.
+func (c *Client) Delete(url string) (*http.Response, error) {
+	return c.DeleteContext(context.Background(), url)
+}
+
+// DeleteContext is like Delete, with a context for the request.
+func (c *Client) DeleteContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.send(ctx, http.MethodDelete, url, "", nil)
+}
+
+// Options issues an OPTIONS request to the specified URL.
+func (c *Client) Options(url string) (*http.Response, error) {
+	return c.OptionsContext(context.Background(), url)
+}
+
+// OptionsContext is like Options, with a context for the request.
+func (c *Client) OptionsContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.send(ctx, http.MethodOptions, url, "", nil)
+}
+
+// send builds a request with the given method, URL and body, and sends it
+// with Do. The Content-Type header is only set if contentType is not empty.
+func (c *Client) send(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.Do(req)
 }
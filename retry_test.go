@@ -552,6 +552,81 @@ func TestClient_VerbMethods(t *testing.T) {
 		}
 		resp.Body.Close()
 	})
+
+	t.Run("AllVerbs", func(t *testing.T) {
+		type received struct {
+			method, contentType, body string
+		}
+		var got received
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bodyBytes, _ := io.ReadAll(r.Body)
+			got = received{r.Method, r.Header.Get("Content-Type"), string(bodyBytes)}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer ts.Close()
+
+		client := New(WithClient(ts.Client()))
+		ctx := context.Background()
+		form := url.Values{"key": {"value"}}
+		tests := []struct {
+			name string
+			call func() (*http.Response, error)
+			want received
+		}{
+			{"GetContext", func() (*http.Response, error) { return client.GetContext(ctx, ts.URL) }, received{http.MethodGet, "", ""}},
+			{"HeadContext", func() (*http.Response, error) { return client.HeadContext(ctx, ts.URL) }, received{http.MethodHead, "", ""}},
+			{"PostContext", func() (*http.Response, error) {
+				return client.PostContext(ctx, ts.URL, "text/plain", strings.NewReader("post"))
+			}, received{http.MethodPost, "text/plain", "post"}},
+			{"PostFormContext", func() (*http.Response, error) { return client.PostFormContext(ctx, ts.URL, form) }, received{http.MethodPost, "application/x-www-form-urlencoded", "key=value"}},
+			{"Put", func() (*http.Response, error) {
+				return client.Put(ts.URL, "application/json", strings.NewReader(`{"a":1}`))
+			}, received{http.MethodPut, "application/json", `{"a":1}`}},
+			{"PutContext", func() (*http.Response, error) {
+				return client.PutContext(ctx, ts.URL, "application/json", strings.NewReader(`{"a":2}`))
+			}, received{http.MethodPut, "application/json", `{"a":2}`}},
+			{"Patch", func() (*http.Response, error) {
+				return client.Patch(ts.URL, "application/merge-patch+json", strings.NewReader(`{"b":1}`))
+			}, received{http.MethodPatch, "application/merge-patch+json", `{"b":1}`}},
+			{"PatchContext", func() (*http.Response, error) {
+				return client.PatchContext(ctx, ts.URL, "application/merge-patch+json", strings.NewReader(`{"b":2}`))
+			}, received{http.MethodPatch, "application/merge-patch+json", `{"b":2}`}},
+			{"Delete", func() (*http.Response, error) { return client.Delete(ts.URL) }, received{http.MethodDelete, "", ""}},
+			{"DeleteContext", func() (*http.Response, error) { return client.DeleteContext(ctx, ts.URL) }, received{http.MethodDelete, "", ""}},
+			{"Options", func() (*http.Response, error) { return client.Options(ts.URL) }, received{http.MethodOptions, "", ""}},
+			{"OptionsContext", func() (*http.Response, error) { return client.OptionsContext(ctx, ts.URL) }, received{http.MethodOptions, "", ""}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, err := tt.call()
+				if err != nil {
+					t.Fatalf("%s returned error: %v", tt.name, err)
+				}
+				resp.Body.Close()
+				if got != tt.want {
+					t.Fatalf("expected request %+v, got %+v", tt.want, got)
+				}
+			})
+		}
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		var attempts atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		client := New(WithClient(ts.Client()))
+		if _, err := client.DeleteContext(ctx, ts.URL); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+		if n := attempts.Load(); n != 0 {
+			t.Fatalf("expected no requests, got %d", n)
+		}
+	})
 }
 
 func TestClient_CloseIdleConnections(t *testing.T) {
@@ -569,3 +644,331 @@ func TestClient_CloseIdleConnections(t *testing.T) {
 		t.Fatal("expected CloseIdleConnections to be called on the transport")
 	}
 }
+
+func TestNewE(t *testing.T) {
+	t.Run("Valid options", func(t *testing.T) {
+		client, err := NewE(
+			WithMaxRetries(0),
+			WithInitialBackoff(time.Second),
+			WithMaxBackoff(time.Second),
+		)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if client.cfg.Load().maxRetries != 0 {
+			t.Fatalf("expected max retries 0, got %d", client.cfg.Load().maxRetries)
+		}
+	})
+
+	t.Run("Initial backoff over the default max backoff", func(t *testing.T) {
+		client, err := NewE(WithInitialBackoff(3 * time.Second))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := client.cfg.Load().maxBackoff; got != 3*time.Second {
+			t.Fatalf("expected max backoff to follow initial backoff, got %s", got)
+		}
+
+		if err := client.Update(WithInitialBackoff(time.Second)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := client.cfg.Load().maxBackoff; got != 2*time.Second {
+			t.Fatalf("expected max backoff to go back to the default, got %s", got)
+		}
+
+		if err := client.Update(WithMaxBackoff(time.Second), WithInitialBackoff(3*time.Second)); !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("expected an error once max backoff is set, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid options are all reported", func(t *testing.T) {
+		client, err := NewE(
+			WithClient(nil),
+			WithMaxRetries(-1),
+			WithCondition(nil),
+			WithBackoffMultiplier(0.5),
+			WithInitialBackoff(time.Second),
+			WithMaxBackoff(time.Millisecond),
+		)
+		if err == nil {
+			t.Fatal("expected an error for invalid options")
+		}
+		if client != nil {
+			t.Fatal("expected no client on error")
+		}
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("expected error to wrap ErrInvalidOption, got: %v", err)
+		}
+		for _, name := range []string{"WithClient", "WithMaxRetries", "WithCondition", "WithBackoffMultiplier", "maximum backoff"} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("expected error to mention %q, got: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("New panics on invalid options", func(t *testing.T) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("expected New to panic")
+			}
+			if err, ok := r.(error); !ok || !errors.Is(err, ErrInvalidOption) {
+				t.Fatalf("expected panic with ErrInvalidOption, got: %v", r)
+			}
+		}()
+		New(WithMaxRetries(-1))
+	})
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// statusTransport answers every request with the given status code.
+func statusTransport(code int) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: code,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Run("New requests use the new settings", func(t *testing.T) {
+		var attempts int32
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&attempts, 1)
+			return statusTransport(http.StatusTooManyRequests).RoundTrip(req)
+		})
+		client := New(
+			WithClient(&http.Client{Transport: transport}),
+			WithMaxRetries(0),
+			WithInitialBackoff(time.Millisecond),
+		)
+
+		if err := client.Update(WithMaxRetries(2)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, err := client.Get("http://example.com"); !errors.Is(err, ErrMaxRetriesExceeded) {
+			t.Fatalf("expected ErrMaxRetriesExceeded, got: %v", err)
+		}
+		if attempts != 3 {
+			t.Fatalf("expected 3 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("In-flight requests keep their snapshot", func(t *testing.T) {
+		var attempts int32
+		started := make(chan struct{})
+		release := make(chan struct{})
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				close(started)
+				<-release
+			}
+			return statusTransport(http.StatusTooManyRequests).RoundTrip(req)
+		})
+		client := New(
+			WithClient(&http.Client{Transport: transport}),
+			WithMaxRetries(0),
+		)
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.Get("http://example.com")
+			errc <- err
+		}()
+
+		<-started
+		if err := client.Update(WithMaxRetries(5), WithInitialBackoff(time.Millisecond)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		close(release)
+
+		if err := <-errc; !errors.Is(err, ErrMaxRetriesExceeded) {
+			t.Fatalf("expected ErrMaxRetriesExceeded, got: %v", err)
+		}
+		if attempts != 1 {
+			t.Fatalf("expected the in-flight request to stop after 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("Invalid update changes nothing", func(t *testing.T) {
+		client := New(WithMaxRetries(3))
+		before := client.cfg.Load()
+
+		if err := client.Update(WithMaxRetries(1), WithClient(nil)); !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("expected ErrInvalidOption, got: %v", err)
+		}
+		if client.cfg.Load() != before {
+			t.Fatal("expected the settings to be left untouched")
+		}
+	})
+
+	t.Run("Concurrent requests and updates", func(t *testing.T) {
+		client := New(
+			WithClient(&http.Client{Transport: statusTransport(http.StatusOK)}),
+		)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 200; i++ {
+				if err := client.Update(WithMaxRetries(i % 5)); err != nil {
+					t.Errorf("unexpected update error: %v", err)
+				}
+			}
+		}()
+
+		errc := make(chan error, 8)
+		for g := 0; g < 8; g++ {
+			go func() {
+				for i := 0; i < 200; i++ {
+					if _, err := client.Get("http://example.com"); err != nil {
+						errc <- err
+						return
+					}
+				}
+				errc <- nil
+			}()
+		}
+		for g := 0; g < 8; g++ {
+			if err := <-errc; err != nil {
+				t.Fatalf("unexpected request error: %v", err)
+			}
+		}
+		<-done
+	})
+}
+
+func BenchmarkClient_Do(b *testing.B) {
+	client := New(
+		WithClient(&http.Client{Transport: statusTransport(http.StatusOK)}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		b.Fatalf("failed to create request: %v", err)
+	}
+
+	b.Run("Parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := client.Do(req.Clone(req.Context())); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+
+	b.Run("ParallelWithMiddleware", func(b *testing.B) {
+		pass := func(next Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				return next.Do(req)
+			})
+		}
+		client := client.With(WithMiddleware(pass, pass), WithAttemptMiddleware(pass, pass))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := client.Do(req.Clone(req.Context())); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+
+	b.Run("ParallelWithUpdates", func(b *testing.B) {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					client.Update(WithMaxRetries(i % 5))
+				}
+			}
+		}()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := client.Do(req.Clone(req.Context())); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func TestClient_With(t *testing.T) {
+	var attempts int32
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		return statusTransport(http.StatusTooManyRequests).RoundTrip(req)
+	})
+	httpClient := &http.Client{Transport: transport}
+	base := New(
+		WithClient(httpClient),
+		WithMaxRetries(1),
+		WithInitialBackoff(time.Millisecond),
+	)
+
+	derived := base.With(WithMaxRetries(3))
+
+	t.Run("Shares the HTTP client and copies settings", func(t *testing.T) {
+		if derived.cfg.Load().client != httpClient {
+			t.Fatal("expected the derived client to share the *http.Client")
+		}
+		if got := base.cfg.Load().maxRetries; got != 1 {
+			t.Fatalf("expected base max retries to stay 1, got %d", got)
+		}
+		if got := derived.cfg.Load().initialBackoff; got != time.Millisecond {
+			t.Fatalf("expected derived client to inherit initial backoff, got %v", got)
+		}
+	})
+
+	t.Run("Each client uses its own settings", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		base.Get("http://example.com")
+		if attempts != 2 {
+			t.Fatalf("expected 2 attempts from the base client, got %d", attempts)
+		}
+
+		atomic.StoreInt32(&attempts, 0)
+		derived.Get("http://example.com")
+		if attempts != 4 {
+			t.Fatalf("expected 4 attempts from the derived client, got %d", attempts)
+		}
+	})
+
+	t.Run("Updating the base does not affect derived clients", func(t *testing.T) {
+		if err := base.Update(WithMaxRetries(0)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := derived.cfg.Load().maxRetries; got != 3 {
+			t.Fatalf("expected derived max retries to stay 3, got %d", got)
+		}
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		if _, err := base.WithE(WithMaxRetries(-1)); !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("expected ErrInvalidOption, got: %v", err)
+		}
+	})
+}
+
+func TestClient_AdaptiveRate_UnknownHost(t *testing.T) {
+	client := New(WithAdaptiveRetry())
+	if got := client.AdaptiveRate("unknown.example.com"); got != 0 {
+		t.Fatalf("expected rate 0, got %g", got)
+	}
+	if _, ok := client.cfg.Load().adaptive.hosts.Load("unknown.example.com"); ok {
+		t.Fatal("expected no state to be stored for a host that was only looked up")
+	}
+}
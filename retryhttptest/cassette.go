@@ -0,0 +1,406 @@
+package retryhttptest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// ErrNoInteraction is returned by a Replayer when a request has no matching,
+// unused interaction in its cassette.
+var ErrNoInteraction = errors.New("retryhttptest: no matching interaction in cassette")
+
+// redactedValue replaces the value of redacted headers in a cassette.
+const redactedValue = "REDACTED"
+
+// Cassette is a recording of HTTP interactions, one per attempt, in the order
+// they happened. It is stored as JSON.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and the response or error it got.
+type Interaction struct {
+	Request  RecordedCall   `json:"request"`
+	Response *RecordedReply `json:"response,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// RecordedCall is the request half of an Interaction.
+type RecordedCall struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	BodySHA256 string      `json:"body_sha256,omitempty"`
+}
+
+// RecordedReply is the response half of an Interaction. Bodies that are not
+// valid UTF-8 are stored base64-encoded.
+type RecordedReply struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+	BodyError    string      `json:"body_error,omitempty"`
+}
+
+// LoadCassette reads a cassette from a JSON file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("retryhttptest: invalid cassette %q: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path as indented JSON.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// MatchRule selects a part of the request used to match it against a
+// recorded interaction.
+type MatchRule int
+
+const (
+	// MatchMethod compares the request method.
+	MatchMethod MatchRule = iota
+	// MatchURL compares the full request URL.
+	MatchURL
+	// MatchBody compares the SHA-256 hash of the request body.
+	MatchBody
+)
+
+// CassetteOption configures a Recorder or a Replayer.
+type CassetteOption func(*cassetteConfig)
+
+type cassetteConfig struct {
+	rules   []MatchRule
+	headers []string
+	redact  []string
+}
+
+func newCassetteConfig(opts []CassetteOption) *cassetteConfig {
+	cfg := &cassetteConfig{
+		rules:  []MatchRule{MatchMethod, MatchURL, MatchBody},
+		redact: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MatchOn replaces the rules used to match requests against interactions.
+// The default is to match on method, URL and body.
+func MatchOn(rules ...MatchRule) CassetteOption {
+	return func(cfg *cassetteConfig) {
+		cfg.rules = rules
+	}
+}
+
+// MatchHeaders additionally requires the given request headers to match.
+// Redacted headers are compared in their redacted form.
+func MatchHeaders(names ...string) CassetteOption {
+	return func(cfg *cassetteConfig) {
+		cfg.headers = append(cfg.headers, names...)
+	}
+}
+
+// Redact adds headers whose values are replaced with "REDACTED" when
+// recorded, in requests and responses. Authorization, Proxy-Authorization,
+// Cookie and Set-Cookie are always redacted.
+func Redact(names ...string) CassetteOption {
+	return func(cfg *cassetteConfig) {
+		cfg.redact = append(cfg.redact, names...)
+	}
+}
+
+func (cfg *cassetteConfig) redactHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	out := h.Clone()
+	for _, name := range cfg.redact {
+		if vs := out.Values(name); len(vs) > 0 {
+			redacted := make([]string, len(vs))
+			for i := range redacted {
+				redacted[i] = redactedValue
+			}
+			out[http.CanonicalHeaderKey(name)] = redacted
+		}
+	}
+	return out
+}
+
+// call captures req, restoring its body so it can still be sent.
+func (cfg *cassetteConfig) call(req *http.Request) (RecordedCall, error) {
+	call := RecordedCall{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: cfg.redactHeader(req.Header),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return call, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		call.BodySHA256 = hex.EncodeToString(sum[:])
+	}
+	return call, nil
+}
+
+func (cfg *cassetteConfig) matches(recorded, actual RecordedCall) bool {
+	for _, rule := range cfg.rules {
+		switch rule {
+		case MatchMethod:
+			if recorded.Method != actual.Method {
+				return false
+			}
+		case MatchURL:
+			if recorded.URL != actual.URL {
+				return false
+			}
+		case MatchBody:
+			if recorded.BodySHA256 != actual.BodySHA256 {
+				return false
+			}
+		}
+	}
+	for _, name := range cfg.headers {
+		if strings.Join(recorded.Header.Values(name), ",") != strings.Join(actual.Header.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// Recorder is an http.RoundTripper that sends requests through another
+// RoundTripper and records every request and response into a Cassette. Placed
+// under a retryhttp.Client, it records each attempt, retries included.
+type Recorder struct {
+	base http.RoundTripper
+	cfg  *cassetteConfig
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+// NewRecorder wraps base, or http.DefaultTransport if base is nil.
+func NewRecorder(base http.RoundTripper, opts ...CassetteOption) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{base: base, cfg: newCassetteConfig(opts)}
+}
+
+// RoundTrip sends req through the wrapped transport and records the outcome.
+// The response body is read in full so it can be recorded, and handed back to
+// the caller as an in-memory copy.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	call, err := r.cfg.call(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		r.record(Interaction{Request: call, Error: err.Error()})
+		return nil, err
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	reply := &RecordedReply{
+		StatusCode: resp.StatusCode,
+		Header:     r.cfg.redactHeader(resp.Header),
+	}
+	reply.setBody(body)
+	if readErr != nil {
+		reply.BodyError = readErr.Error()
+	}
+	r.record(Interaction{Request: call, Response: reply})
+
+	resp.Body = &replayBody{r: bytes.NewReader(body), err: readErr}
+	return resp, nil
+}
+
+// Cassette returns a copy of the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes the interactions recorded so far to path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+func (r *Recorder) record(in Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+}
+
+// Replayer is an http.RoundTripper that answers requests from a Cassette
+// without touching the network. Each interaction is used at most once, in
+// recorded order, so retries replay the attempts exactly as recorded.
+type Replayer struct {
+	t   testing.TB
+	cfg *cassetteConfig
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+var _ http.RoundTripper = (*Replayer)(nil)
+
+// NewReplayer returns a Replayer for cassette. If t is not nil, a request
+// without a matching interaction also fails the test.
+func NewReplayer(t testing.TB, cassette *Cassette, opts ...CassetteOption) *Replayer {
+	return &Replayer{
+		t:        t,
+		cfg:      newCassetteConfig(opts),
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// RoundTrip answers req with the first unused interaction that matches it.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	call, err := r.cfg.call(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	in, ok := r.take(call)
+	if !ok {
+		err := fmt.Errorf("%w: %s %s", ErrNoInteraction, call.Method, call.URL)
+		if r.t != nil {
+			r.t.Errorf("%v", err)
+		}
+		return nil, err
+	}
+
+	if in.Response == nil {
+		return nil, errors.New(in.Error)
+	}
+
+	body, err := in.Response.body()
+	if err != nil {
+		return nil, err
+	}
+	var bodyErr error
+	if in.Response.BodyError != "" {
+		bodyErr = errors.New(in.Response.BodyError)
+	}
+
+	header := in.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(in.Response.StatusCode) + " " + http.StatusText(in.Response.StatusCode),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          &replayBody{r: bytes.NewReader(body), err: bodyErr},
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Remaining returns how many interactions have not been replayed yet.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replayer) take(call RecordedCall) (Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || !r.cfg.matches(in.Request, call) {
+			continue
+		}
+		r.used[i] = true
+		return in, true
+	}
+	return Interaction{}, false
+}
+
+func (rr *RecordedReply) setBody(body []byte) {
+	if utf8.Valid(body) {
+		rr.Body = string(body)
+		return
+	}
+	rr.Body = base64.StdEncoding.EncodeToString(body)
+	rr.BodyEncoding = "base64"
+}
+
+func (rr *RecordedReply) body() ([]byte, error) {
+	switch rr.BodyEncoding {
+	case "":
+		return []byte(rr.Body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(rr.Body)
+	default:
+		return nil, fmt.Errorf("retryhttptest: unknown body encoding %q", rr.BodyEncoding)
+	}
+}
+
+// replayBody serves an in-memory body, failing with err once it is drained.
+type replayBody struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (rb *replayBody) Read(p []byte) (int, error) {
+	n, err := rb.r.Read(p)
+	if err == io.EOF && rb.err != nil {
+		return n, rb.err
+	}
+	return n, err
+}
+
+func (rb *replayBody) Close() error { return nil }
@@ -0,0 +1,124 @@
+package retryhttptest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+// recordingTB captures test failures instead of failing the real test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	srv := NewServer(
+		Step{Status: http.StatusTooManyRequests},
+		Step{Status: http.StatusOK, Header: http.Header{"Set-Cookie": {"session=secret"}}, Body: "created"},
+	)
+	recorder := NewRecorder(srv.Client().Transport)
+	client := retryhttp.New(
+		retryhttp.WithClient(&http.Client{Transport: recorder}),
+		retryhttp.WithInitialBackoff(time.Millisecond),
+	)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/items", strings.NewReader(`{"name":"a"}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error while recording, got: %v", err)
+	}
+	resp.Body.Close()
+	srv.Close()
+
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("failed to save cassette: %v", err)
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+
+	t.Run("Records every attempt with redaction", func(t *testing.T) {
+		if got := len(cassette.Interactions); got != 2 {
+			t.Fatalf("expected 2 recorded attempts, got %d", got)
+		}
+		for _, in := range cassette.Interactions {
+			if got := in.Request.Header.Get("Authorization"); got != redactedValue {
+				t.Fatalf("expected Authorization to be redacted, got %q", got)
+			}
+		}
+		last := cassette.Interactions[1].Response
+		if got := last.Header.Get("Set-Cookie"); got != redactedValue {
+			t.Fatalf("expected Set-Cookie to be redacted, got %q", got)
+		}
+		if last.Body != "created" {
+			t.Fatalf("expected recorded body %q, got %q", "created", last.Body)
+		}
+	})
+
+	t.Run("Replays attempts offline", func(t *testing.T) {
+		replayer := NewReplayer(t, cassette)
+		client := retryhttp.New(
+			retryhttp.WithClient(&http.Client{Transport: replayer}),
+			retryhttp.WithInitialBackoff(time.Millisecond),
+		)
+
+		resp, err := client.Post(srv.URL+"/items", "application/json", strings.NewReader(`{"name":"a"}`))
+		if err != nil {
+			t.Fatalf("expected no error while replaying, got: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "created" {
+			t.Fatalf("unexpected replayed response: %d %q", resp.StatusCode, body)
+		}
+		if got := replayer.Remaining(); got != 0 {
+			t.Fatalf("expected every interaction to be used, %d left", got)
+		}
+	})
+
+	t.Run("Unmatched request fails the test", func(t *testing.T) {
+		tb := &recordingTB{TB: t}
+		replayer := NewReplayer(tb, cassette)
+
+		_, err := (&http.Client{Transport: replayer}).Post(srv.URL+"/items", "application/json", strings.NewReader(`{"name":"b"}`))
+		if !errors.Is(err, ErrNoInteraction) {
+			t.Fatalf("expected ErrNoInteraction, got: %v", err)
+		}
+		if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "/items") {
+			t.Fatalf("expected a test failure naming the request, got %v", tb.errors)
+		}
+	})
+
+	t.Run("Custom match rules", func(t *testing.T) {
+		replayer := NewReplayer(t, cassette, MatchOn(MatchMethod, MatchURL))
+
+		resp, err := (&http.Client{Transport: replayer}).Post(srv.URL+"/items", "application/json", strings.NewReader("different"))
+		if err != nil {
+			t.Fatalf("expected body to be ignored, got: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected first recorded attempt, got status %d", resp.StatusCode)
+		}
+	})
+}
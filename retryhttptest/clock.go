@@ -0,0 +1,168 @@
+// Package retryhttptest provides utilities for testing code built on top of
+// retryhttp, such as a fake clock that can be advanced by hand and a server
+// that plays back scripted, flaky responses.
+package retryhttptest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+var _ retryhttp.Clock = (*FakeClock)(nil)
+
+// FakeClock is a retryhttp.Clock whose time only moves when Advance or Set is
+// called. Timers created from it fire once the fake time reaches their
+// deadline. It is safe for concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+	history []time.Duration
+}
+
+// NewFakeClock returns a FakeClock whose current time is start.
+func NewFakeClock(start time.Time) *FakeClock {
+	fc := &FakeClock{now: start}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+// Now returns the current fake time.
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// NewTimer creates a timer that fires once the fake time has advanced by d.
+// A timer with a non-positive duration fires immediately.
+func (fc *FakeClock) NewTimer(d time.Duration) retryhttp.Timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	t := &fakeTimer{
+		clock:    fc,
+		deadline: fc.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+	fc.history = append(fc.history, d)
+	if d <= 0 {
+		t.c <- fc.now
+		t.fired = true
+	} else {
+		fc.timers = append(fc.timers, t)
+	}
+	fc.cond.Broadcast()
+	return t
+}
+
+// Advance moves the fake time forward by d and fires every timer whose
+// deadline has been reached.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.setLocked(fc.now.Add(d))
+}
+
+// Set moves the fake time to t and fires every timer whose deadline has been
+// reached. Moving the time backwards does not fire anything.
+func (fc *FakeClock) Set(t time.Time) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.setLocked(t)
+}
+
+// AdvanceToNext moves the fake time to the earliest pending timer deadline,
+// firing it, and returns how far the time moved. It returns zero if no timer
+// is pending.
+func (fc *FakeClock) AdvanceToNext() time.Duration {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if len(fc.timers) == 0 {
+		return 0
+	}
+	sort.Slice(fc.timers, func(i, j int) bool {
+		return fc.timers[i].deadline.Before(fc.timers[j].deadline)
+	})
+	d := fc.timers[0].deadline.Sub(fc.now)
+	fc.setLocked(fc.timers[0].deadline)
+	return d
+}
+
+// Pending returns the number of timers that have not fired or been stopped.
+func (fc *FakeClock) Pending() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(fc.timers)
+}
+
+// BlockUntil blocks until at least n timers are pending. It is used to wait
+// for the code under test to start sleeping before advancing the clock.
+func (fc *FakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for len(fc.timers) < n {
+		fc.cond.Wait()
+	}
+}
+
+// Durations returns the duration of every timer created so far, in creation
+// order. It can be used to assert the complete backoff schedule of a client.
+func (fc *FakeClock) Durations() []time.Duration {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return append([]time.Duration(nil), fc.history...)
+}
+
+func (fc *FakeClock) setLocked(t time.Time) {
+	if t.After(fc.now) {
+		fc.now = t
+	}
+
+	pending := fc.timers[:0]
+	for _, timer := range fc.timers {
+		if timer.deadline.After(fc.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.fired = true
+		timer.c <- fc.now
+	}
+	fc.timers = pending
+	fc.cond.Broadcast()
+}
+
+func (fc *FakeClock) removeLocked(t *fakeTimer) bool {
+	for i, timer := range fc.timers {
+		if timer == t {
+			fc.timers = append(fc.timers[:i], fc.timers[i+1:]...)
+			fc.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is a Timer created by a FakeClock.
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+	fired    bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	if t.fired {
+		return false
+	}
+	return t.clock.removeLocked(t)
+}
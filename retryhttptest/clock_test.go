@@ -0,0 +1,67 @@
+package retryhttptest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Advance fires due timers", func(t *testing.T) {
+		fc := NewFakeClock(start)
+		short := fc.NewTimer(10 * time.Millisecond)
+		long := fc.NewTimer(50 * time.Millisecond)
+
+		fc.Advance(20 * time.Millisecond)
+		select {
+		case <-short.C():
+		default:
+			t.Fatal("expected short timer to fire")
+		}
+		select {
+		case <-long.C():
+			t.Fatal("expected long timer to still be pending")
+		default:
+		}
+		if got := fc.Pending(); got != 1 {
+			t.Fatalf("expected 1 pending timer, got %d", got)
+		}
+		if got := fc.Now(); !got.Equal(start.Add(20 * time.Millisecond)) {
+			t.Fatalf("unexpected fake time: %v", got)
+		}
+	})
+
+	t.Run("Stop removes pending timer", func(t *testing.T) {
+		fc := NewFakeClock(start)
+		timer := fc.NewTimer(time.Second)
+		if !timer.Stop() {
+			t.Fatal("expected Stop to report the timer as stopped")
+		}
+		if timer.Stop() {
+			t.Fatal("expected second Stop to return false")
+		}
+		if got := fc.Pending(); got != 0 {
+			t.Fatalf("expected no pending timers, got %d", got)
+		}
+	})
+
+	t.Run("AdvanceToNext and BlockUntil", func(t *testing.T) {
+		fc := NewFakeClock(start)
+		done := make(chan struct{})
+		go func() {
+			<-fc.NewTimer(30 * time.Millisecond).C()
+			close(done)
+		}()
+
+		fc.BlockUntil(1)
+		if d := fc.AdvanceToNext(); d != 30*time.Millisecond {
+			t.Fatalf("expected to advance 30ms, got %v", d)
+		}
+		<-done
+
+		if got := fc.Durations(); len(got) != 1 || got[0] != 30*time.Millisecond {
+			t.Fatalf("unexpected recorded durations: %v", got)
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package retryhttptest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+// FaultKind identifies the kind of misbehavior injected by a FaultTransport.
+type FaultKind int
+
+const (
+	// FaultNone passes the request through untouched.
+	FaultNone FaultKind = iota
+	// FaultLatency delays the request before passing it through.
+	FaultLatency
+	// FaultConnRefused fails the request with a "connection refused" dial error.
+	FaultConnRefused
+	// FaultConnReset fails the request with a "connection reset by peer" error.
+	FaultConnReset
+	// FaultTimeout fails the request with an error that reports Timeout() == true.
+	FaultTimeout
+	// FaultStatus answers with a synthetic status code, optionally with Retry-After.
+	FaultStatus
+	// FaultTruncatedBody passes the request through but cuts the response body short.
+	FaultTruncatedBody
+	// FaultSlowBody passes the request through but drips the response body slowly.
+	FaultSlowBody
+)
+
+var faultKindNames = map[FaultKind]string{
+	FaultNone:          "none",
+	FaultLatency:       "latency",
+	FaultConnRefused:   "connection refused",
+	FaultConnReset:     "connection reset",
+	FaultTimeout:       "timeout",
+	FaultStatus:        "status",
+	FaultTruncatedBody: "truncated body",
+	FaultSlowBody:      "slow body",
+}
+
+func (k FaultKind) String() string {
+	if name, ok := faultKindNames[k]; ok {
+		return name
+	}
+	return "FaultKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Fault describes a single injected failure. Use the constructor functions
+// such as Latency, ConnRefused or Status to build one.
+type Fault struct {
+	Kind FaultKind
+
+	// Delay is waited before the fault takes effect, for every kind.
+	Delay time.Duration
+
+	// Status and RetryAfter are used by FaultStatus.
+	Status     int
+	RetryAfter string
+
+	// Bytes is the number of body bytes delivered before a FaultTruncatedBody
+	// cuts the body short, or the size of each chunk of a FaultSlowBody.
+	Bytes int
+
+	// Interval is the wait between chunks of a FaultSlowBody.
+	Interval time.Duration
+}
+
+// NoFault passes the request through untouched.
+func NoFault() Fault { return Fault{Kind: FaultNone} }
+
+// Latency delays the request by d before passing it through.
+func Latency(d time.Duration) Fault { return Fault{Kind: FaultLatency, Delay: d} }
+
+// ConnRefused fails the request as if nothing was listening on the remote port.
+func ConnRefused() Fault { return Fault{Kind: FaultConnRefused} }
+
+// ConnReset fails the request as if the remote end reset the connection.
+func ConnReset() Fault { return Fault{Kind: FaultConnReset} }
+
+// Timeout fails the request with a timeout error after waiting d.
+func Timeout(d time.Duration) Fault { return Fault{Kind: FaultTimeout, Delay: d} }
+
+// Status answers the request with code without reaching the wrapped
+// transport. A non-zero retryAfter is sent as a Retry-After header in seconds.
+func Status(code int, retryAfter time.Duration) Fault {
+	f := Fault{Kind: FaultStatus, Status: code}
+	if retryAfter > 0 {
+		f.RetryAfter = strconv.Itoa(int(retryAfter.Round(time.Second) / time.Second))
+	}
+	return f
+}
+
+// TruncatedBody lets n bytes of the real response body through and then
+// fails reads with io.ErrUnexpectedEOF.
+func TruncatedBody(n int) Fault { return Fault{Kind: FaultTruncatedBody, Bytes: n} }
+
+// SlowBody delivers the real response body in chunks of size bytes, waiting
+// interval before each chunk.
+func SlowBody(size int, interval time.Duration) Fault {
+	return Fault{Kind: FaultSlowBody, Bytes: size, Interval: interval}
+}
+
+// FaultRule injects a fault with the given probability, between 0 and 1.
+type FaultRule struct {
+	Probability float64
+	Fault       Fault
+}
+
+// FaultTransport is an http.RoundTripper that wraps another one and injects
+// faults, either from a fixed schedule or at random from a set of rules. The
+// random source is seeded, so a run can be reproduced exactly. It is meant to
+// be placed under a retryhttp.Client through retryhttp.WithClient.
+type FaultTransport struct {
+	base  http.RoundTripper
+	clock retryhttp.Clock
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	schedule []Fault
+	rules    []FaultRule
+	injected []FaultKind
+}
+
+var _ http.RoundTripper = (*FaultTransport)(nil)
+
+// NewFaultTransport wraps base, or http.DefaultTransport if base is nil, and
+// seeds the random source used by probabilistic rules with seed.
+func NewFaultTransport(base http.RoundTripper, seed int64) *FaultTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &FaultTransport{
+		base: base,
+		rng:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// SetClock makes every delay injected by the transport wait on clock instead
+// of real time, such as a FakeClock.
+func (ft *FaultTransport) SetClock(clock retryhttp.Clock) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.clock = clock
+}
+
+// Schedule queues faults to be applied, in order, to the next requests. While
+// the schedule is not empty, probabilistic rules are not consulted.
+func (ft *FaultTransport) Schedule(faults ...Fault) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.schedule = append(ft.schedule, faults...)
+}
+
+// Inject adds a rule that applies fault to a request with the given
+// probability. Rules are evaluated in the order they were added, against a
+// single random draw per request, so their probabilities should add up to at
+// most 1.
+func (ft *FaultTransport) Inject(probability float64, fault Fault) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.rules = append(ft.rules, FaultRule{Probability: probability, Fault: fault})
+}
+
+// Injected returns the kind of fault applied to every request so far, in
+// order. Requests that passed through untouched are recorded as FaultNone.
+func (ft *FaultTransport) Injected() []FaultKind {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	return append([]FaultKind(nil), ft.injected...)
+}
+
+// CloseIdleConnections forwards to the wrapped transport, if it supports it.
+func (ft *FaultTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := ft.base.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// RoundTrip applies the next fault, if any, to req.
+func (ft *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, clock := ft.next()
+
+	if fault.Delay > 0 {
+		if err := wait(req.Context(), clock, fault.Delay); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+	}
+
+	switch fault.Kind {
+	case FaultConnRefused:
+		closeBody(req)
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	case FaultConnReset:
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case FaultTimeout:
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errInjectedTimeout}
+	case FaultStatus:
+		closeBody(req)
+		return syntheticResponse(req, fault), nil
+	}
+
+	resp, err := ft.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch fault.Kind {
+	case FaultTruncatedBody:
+		resp.Body = &truncatedBody{rc: resp.Body, remaining: fault.Bytes}
+	case FaultSlowBody:
+		resp.Body = &slowBody{rc: resp.Body, ctx: req.Context(), clock: clock, size: max(fault.Bytes, 1), interval: fault.Interval}
+	}
+	return resp, nil
+}
+
+// next picks the fault for the current request and records it.
+func (ft *FaultTransport) next() (Fault, retryhttp.Clock) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	fault := NoFault()
+	if len(ft.schedule) > 0 {
+		fault = ft.schedule[0]
+		ft.schedule = ft.schedule[1:]
+	} else if len(ft.rules) > 0 {
+		draw := ft.rng.Float64()
+		var cumulative float64
+		for _, rule := range ft.rules {
+			cumulative += rule.Probability
+			if draw < cumulative {
+				fault = rule.Fault
+				break
+			}
+		}
+	}
+
+	ft.injected = append(ft.injected, fault.Kind)
+	return fault, ft.clock
+}
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout (injected)" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errInjectedTimeout net.Error = timeoutError{}
+
+func syntheticResponse(req *http.Request, fault Fault) *http.Response {
+	header := make(http.Header)
+	if fault.RetryAfter != "" {
+		header.Set("Retry-After", fault.RetryAfter)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(fault.Status) + " " + http.StatusText(fault.Status),
+		StatusCode:    fault.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader("")),
+		ContentLength: 0,
+		Request:       req,
+	}
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// wait blocks for d on clock, or on real time if clock is nil.
+func wait(ctx context.Context, clock retryhttp.Clock, d time.Duration) error {
+	var c <-chan time.Time
+	if clock != nil {
+		timer := clock.NewTimer(d)
+		defer timer.Stop()
+		c = timer.C()
+	} else {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		c = timer.C
+	}
+
+	select {
+	case <-c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// truncatedBody lets a number of bytes through and then fails.
+type truncatedBody struct {
+	rc        io.ReadCloser
+	remaining int
+}
+
+func (tb *truncatedBody) Read(p []byte) (int, error) {
+	if tb.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > tb.remaining {
+		p = p[:tb.remaining]
+	}
+	n, err := tb.rc.Read(p)
+	tb.remaining -= n
+	if errors.Is(err, io.EOF) && tb.remaining > 0 {
+		// The real body was shorter than the cut-off point.
+		return n, io.EOF
+	}
+	if tb.remaining <= 0 && err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (tb *truncatedBody) Close() error { return tb.rc.Close() }
+
+// slowBody delivers the wrapped body in small chunks with a wait before each.
+type slowBody struct {
+	rc       io.ReadCloser
+	ctx      context.Context
+	clock    retryhttp.Clock
+	size     int
+	interval time.Duration
+}
+
+func (sb *slowBody) Read(p []byte) (int, error) {
+	if sb.interval > 0 {
+		if err := wait(sb.ctx, sb.clock, sb.interval); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > sb.size {
+		p = p[:sb.size]
+	}
+	return sb.rc.Read(p)
+}
+
+func (sb *slowBody) Close() error { return sb.rc.Close() }
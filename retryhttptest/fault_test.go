@@ -0,0 +1,162 @@
+package retryhttptest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+func TestFaultTransport(t *testing.T) {
+	t.Run("Scheduled faults under a retrying client", func(t *testing.T) {
+		srv := NewServer(Step{Body: "ok"})
+		defer srv.Close()
+
+		ft := NewFaultTransport(srv.Client().Transport, 1)
+		ft.Schedule(ConnRefused(), ConnReset(), Timeout(0), Status(http.StatusTooManyRequests, 0))
+
+		client := retryhttp.New(
+			retryhttp.WithClient(&http.Client{Transport: ft}),
+			retryhttp.WithInitialBackoff(time.Millisecond),
+		)
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Fatalf("expected body %q, got %q", "ok", body)
+		}
+
+		expected := []FaultKind{FaultConnRefused, FaultConnReset, FaultTimeout, FaultStatus, FaultNone}
+		if got := ft.Injected(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected faults %v, got %v", expected, got)
+		}
+		srv.AssertAttempts(t, 1)
+	})
+
+	t.Run("Injected errors look like real network errors", func(t *testing.T) {
+		ft := NewFaultTransport(http.DefaultTransport, 1)
+		ft.Schedule(ConnRefused(), ConnReset(), Timeout(0))
+		client := &http.Client{Transport: ft}
+
+		_, err := client.Get("http://example.invalid")
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("expected ECONNREFUSED, got: %v", err)
+		}
+		_, err = client.Get("http://example.invalid")
+		if !errors.Is(err, syscall.ECONNRESET) {
+			t.Fatalf("expected ECONNRESET, got: %v", err)
+		}
+		_, err = client.Get("http://example.invalid")
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("expected a timeout error, got: %v", err)
+		}
+	})
+
+	t.Run("Status fault carries Retry-After", func(t *testing.T) {
+		ft := NewFaultTransport(http.DefaultTransport, 1)
+		ft.Schedule(Status(http.StatusTooManyRequests, 3*time.Second))
+
+		resp, err := (&http.Client{Transport: ft}).Get("http://example.invalid")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "3" {
+			t.Fatalf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+		}
+	})
+
+	t.Run("Truncated and slow bodies", func(t *testing.T) {
+		srv := NewServer(Step{Body: "0123456789"})
+		defer srv.Close()
+
+		clock := NewFakeClock(time.Now())
+		ft := NewFaultTransport(srv.Client().Transport, 1)
+		ft.SetClock(clock)
+		ft.Schedule(TruncatedBody(4), SlowBody(5, time.Second))
+		client := &http.Client{Transport: ft}
+
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !errors.Is(err, io.ErrUnexpectedEOF) || string(body) != "0123" {
+			t.Fatalf("expected truncated body %q, got %q (%v)", "0123", body, err)
+		}
+
+		resp, err = client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var sb strings.Builder
+		done := make(chan error, 1)
+		go func() {
+			_, err := io.Copy(&sb, resp.Body)
+			done <- err
+		}()
+	drip:
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("expected no error reading slow body, got: %v", err)
+				}
+				break drip
+			default:
+				clock.AdvanceToNext()
+				runtime.Gosched()
+			}
+		}
+		if got := len(clock.Durations()); got < 2 {
+			t.Fatalf("expected the body to be delivered in at least 2 chunks, got %d", got)
+		}
+		if sb.String() != "0123456789" {
+			t.Fatalf("expected full body, got %q", sb.String())
+		}
+	})
+
+	t.Run("Probabilistic faults are reproducible with a seed", func(t *testing.T) {
+		run := func() []FaultKind {
+			ft := NewFaultTransport(http.DefaultTransport, 42)
+			ft.Inject(0.3, ConnReset())
+			ft.Inject(0.3, Status(http.StatusBadGateway, 0))
+			ft.Inject(0.4, ConnRefused())
+			client := &http.Client{Transport: ft}
+			for i := 0; i < 20; i++ {
+				resp, err := client.Get("http://example.invalid")
+				if err == nil {
+					resp.Body.Close()
+				}
+			}
+			return ft.Injected()
+		}
+
+		first, second := run(), run()
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("expected identical fault sequences, got %v and %v", first, second)
+		}
+		seen := make(map[FaultKind]bool)
+		for _, k := range first {
+			seen[k] = true
+		}
+		if len(seen) != 3 {
+			t.Fatalf("expected all three faults to be injected, got %v", first)
+		}
+	})
+}
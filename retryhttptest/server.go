@@ -0,0 +1,262 @@
+package retryhttptest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Step describes how a Server answers a single request.
+type Step struct {
+	// Status is the response status code. It defaults to 200.
+	Status int
+
+	// Header is added to the response headers.
+	Header http.Header
+
+	// Body is written as the response body.
+	Body string
+
+	// Delay is waited before the response is written. The wait is cut short
+	// if the client goes away.
+	Delay time.Duration
+
+	// Reset closes the connection abruptly without sending a response.
+	Reset bool
+
+	// Hang blocks until the client gives up or the server is closed,
+	// without ever sending a response.
+	Hang bool
+
+	// Truncate announces the full body length in Content-Length but only
+	// writes the first half of Body before closing the connection.
+	Truncate bool
+}
+
+// Repeat returns a script made of n copies of step.
+func Repeat(n int, step Step) []Step {
+	steps := make([]Step, n)
+	for i := range steps {
+		steps[i] = step
+	}
+	return steps
+}
+
+// RecordedRequest is a copy of a request received by a Server.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+}
+
+// script is a sequence of steps played back in order. Once it runs out, the
+// last step is repeated.
+type script struct {
+	steps []Step
+	next  int
+}
+
+func (s *script) step() Step {
+	if len(s.steps) == 0 {
+		return Step{}
+	}
+	step := s.steps[min(s.next, len(s.steps)-1)]
+	s.next++
+	return step
+}
+
+// Server is an httptest.Server that plays back scripted responses, either
+// for every request or per request path, and records every request it
+// receives for later assertions.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fallback *script
+	paths    map[string]*script
+	requests []RecordedRequest
+	closing  chan struct{}
+	once     sync.Once
+}
+
+// NewServer starts a Server that answers requests with the given steps, in
+// order, regardless of the request path. Once the steps run out, the last
+// one is repeated; with no steps at all, every request gets a 200.
+func NewServer(steps ...Step) *Server {
+	s := &Server{
+		fallback: &script{steps: steps},
+		paths:    make(map[string]*script),
+		closing:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Handle scripts the responses for requests to path. Requests to a scripted
+// path advance their own sequence, independently of other paths.
+func (s *Server) Handle(path string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[path] = &script{steps: steps}
+}
+
+// Requests returns a copy of every request received so far, in order.
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest(nil), s.requests...)
+}
+
+// Attempts returns how many requests the server has received.
+func (s *Server) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+// AttemptsFor returns how many requests the server has received for path.
+func (s *Server) AttemptsFor(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for _, r := range s.requests {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// AssertAttempts fails the test if the server did not receive exactly n
+// requests.
+func (s *Server) AssertAttempts(t testing.TB, n int) {
+	t.Helper()
+	if got := s.Attempts(); got != n {
+		t.Fatalf("expected %d attempts, got %d", n, got)
+	}
+}
+
+// AssertAttemptsFor fails the test if the server did not receive exactly n
+// requests for path.
+func (s *Server) AssertAttemptsFor(t testing.TB, path string, n int) {
+	t.Helper()
+	if got := s.AttemptsFor(path); got != n {
+		t.Fatalf("expected %d attempts for %q, got %d", n, path, got)
+	}
+}
+
+// Close releases any hanging requests and shuts the server down.
+func (s *Server) Close() {
+	s.once.Do(func() { close(s.closing) })
+	s.Server.Close()
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	})
+	sc, ok := s.paths[r.URL.Path]
+	if !ok {
+		sc = s.fallback
+	}
+	step := sc.step()
+	s.mu.Unlock()
+
+	if step.Delay > 0 {
+		timer := time.NewTimer(step.Delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		case <-s.closing:
+			timer.Stop()
+			return
+		}
+	}
+
+	switch {
+	case step.Hang:
+		select {
+		case <-r.Context().Done():
+		case <-s.closing:
+		}
+	case step.Reset:
+		s.reset(w)
+	case step.Truncate:
+		s.truncate(w, step)
+	default:
+		for k, vs := range step.Header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		status := step.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, step.Body)
+	}
+}
+
+// reset closes the underlying connection, asking the kernel to send a RST
+// instead of a graceful FIN where possible.
+func (s *Server) reset(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(fmt.Sprintf("retryhttptest: cannot hijack connection: %v", err))
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// truncate writes a raw response whose body is shorter than its declared
+// Content-Length, then closes the connection.
+func (s *Server) truncate(w http.ResponseWriter, step Step) {
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(fmt.Sprintf("retryhttptest: cannot hijack connection: %v", err))
+	}
+	defer conn.Close()
+
+	status := step.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := step.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(step.Body)))
+
+	writeRaw(buf.Writer, status, header, step.Body[:len(step.Body)/2])
+}
+
+func writeRaw(bw *bufio.Writer, status int, header http.Header, body string) {
+	fmt.Fprintf(bw, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	header.Write(bw)
+	bw.WriteString("\r\n")
+	bw.WriteString(body)
+	bw.Flush()
+}
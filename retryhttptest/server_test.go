@@ -0,0 +1,107 @@
+package retryhttptest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+func TestServer(t *testing.T) {
+	t.Run("Plays back steps then repeats the last one", func(t *testing.T) {
+		srv := NewServer(
+			Step{Status: http.StatusServiceUnavailable},
+			Step{Status: http.StatusCreated, Header: http.Header{"X-Test": {"yes"}}, Body: "done"},
+		)
+		defer srv.Close()
+
+		for i, expected := range []int{http.StatusServiceUnavailable, http.StatusCreated, http.StatusCreated} {
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("request %d failed: %v", i, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != expected {
+				t.Fatalf("request %d: expected status %d, got %d", i, expected, resp.StatusCode)
+			}
+			if expected == http.StatusCreated {
+				if string(body) != "done" || resp.Header.Get("X-Test") != "yes" {
+					t.Fatalf("request %d: unexpected response %q %v", i, body, resp.Header)
+				}
+			}
+		}
+		srv.AssertAttempts(t, 3)
+	})
+
+	t.Run("Per path scripts and recorded requests", func(t *testing.T) {
+		srv := NewServer()
+		defer srv.Close()
+		srv.Handle("/flaky", Step{Status: http.StatusTooManyRequests}, Step{})
+
+		client := retryhttp.New(
+			retryhttp.WithInitialBackoff(time.Millisecond),
+		)
+		resp, err := client.Post(srv.URL+"/flaky?x=1", "text/plain", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		resp, err = client.Get(srv.URL + "/other")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		srv.AssertAttemptsFor(t, "/flaky", 2)
+		srv.AssertAttemptsFor(t, "/other", 1)
+
+		reqs := srv.Requests()
+		for _, r := range reqs[:2] {
+			if r.Method != http.MethodPost || string(r.Body) != "payload" || r.Query != "x=1" {
+				t.Fatalf("unexpected recorded request: %+v", r)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "text/plain" {
+				t.Fatalf("expected recorded content type, got %q", ct)
+			}
+		}
+	})
+
+	t.Run("Connection reset", func(t *testing.T) {
+		srv := NewServer(Step{Reset: true})
+		defer srv.Close()
+
+		if _, err := http.Get(srv.URL); err == nil {
+			t.Fatal("expected an error from a reset connection")
+		}
+	})
+
+	t.Run("Truncated body", func(t *testing.T) {
+		srv := NewServer(Step{Body: "0123456789", Truncate: true})
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expected headers to arrive, got: %v", err)
+		}
+		defer resp.Body.Close()
+		if _, err := io.ReadAll(resp.Body); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected io.ErrUnexpectedEOF, got: %v", err)
+		}
+	})
+
+	t.Run("Hang until the client gives up", func(t *testing.T) {
+		srv := NewServer(Step{Hang: true})
+		defer srv.Close()
+
+		client := &http.Client{Timeout: 50 * time.Millisecond}
+		if _, err := client.Get(srv.URL); err == nil {
+			t.Fatal("expected a timeout error")
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package retryhttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// WithAddressRotation makes the client resolve hosts itself with r, and dial
+// a different address of the host on each attempt, so a retry does not land
+// on the same broken backend again. If r is nil, net.DefaultResolver is used.
+//
+// Only the dialed address changes: the URL, and with it the Host header and
+// the TLS server name, stay the same. Each address gets its own connection
+// pool, and after a failed attempt the idle connections to its address are
+// closed, so they are not reused later. Rotation needs the transport of the
+// underlying *http.Client to be an *http.Transport, or nil; with any other
+// transport, or when a request goes through a proxy, such as one set in the
+// HTTPS_PROXY environment variable, requests are sent unchanged and
+// AttemptInfo.Address is empty.
+func WithAddressRotation(r Resolver) Option {
+	return func(cfg *config) error {
+		if r == nil {
+			r = net.DefaultResolver
+		}
+		cfg.rotation = &addressRotation{resolver: r}
+		return nil
+	}
+}
+
+// addressRotation holds the resolver, the rotation offset of each host and
+// one transport per dialed address.
+type addressRotation struct {
+	resolver   Resolver
+	offsets    sync.Map // map[string]*atomic.Uint64
+	transports sync.Map // map[routeKey]*http.Transport
+}
+
+// routeKey identifies the transport that dials ip for target, derived from
+// base.
+type routeKey struct {
+	base   *http.Transport
+	target string
+	ip     string
+}
+
+// route is how a single attempt is sent.
+type route struct {
+	client    *http.Client
+	address   string
+	transport *http.Transport
+}
+
+// offset returns where the rotation of host starts for a new request, so
+// consecutive requests also spread over the addresses.
+func (ar *addressRotation) offset(host string) uint64 {
+	v, _ := ar.offsets.LoadOrStore(host, new(atomic.Uint64))
+	return v.(*atomic.Uint64).Add(1) - 1
+}
+
+// route picks the address to dial for an attempt of req, numbered n from the
+// offset of the request. If the host cannot be rotated, it returns a route
+// using client unchanged.
+func (ar *addressRotation) route(ctx context.Context, client *http.Client, req *http.Request, n uint64) (route, error) {
+	base, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		base, ok = http.DefaultTransport.(*http.Transport)
+	}
+	host := req.URL.Hostname()
+	if !ok || host == "" || net.ParseIP(host) != nil {
+		return route{client: client}, nil
+	}
+	// Through a proxy, the connection is made to the proxy, not to host.
+	if base.Proxy != nil {
+		if proxy, err := base.Proxy(req); err != nil || proxy != nil {
+			return route{client: client}, nil
+		}
+	}
+
+	addrs, err := ar.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return route{}, err
+	}
+	if len(addrs) == 0 {
+		return route{}, fmt.Errorf("no addresses found for %s", host)
+	}
+	addrs = slices.Clone(addrs)
+	slices.Sort(addrs)
+	ip := addrs[n%uint64(len(addrs))]
+
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	key := routeKey{base: base, target: net.JoinHostPort(host, port), ip: ip}
+
+	tr, ok := ar.transports.Load(key)
+	if !ok {
+		tr, _ = ar.transports.LoadOrStore(key, newRouteTransport(key))
+	}
+	routed := *client
+	routed.Transport = tr.(*http.Transport)
+	return route{client: &routed, address: net.JoinHostPort(ip, port), transport: routed.Transport.(*http.Transport)}, nil
+}
+
+// closeIdleConnections closes the idle connections of every address.
+func (ar *addressRotation) closeIdleConnections() {
+	ar.transports.Range(func(_, value any) bool {
+		value.(*http.Transport).CloseIdleConnections()
+		return true
+	})
+}
+
+// newRouteTransport returns a copy of key.base that dials key.ip whenever it
+// connects to key.target. Other connections, such as those made to follow a
+// redirect to another host, are dialed as usual.
+func newRouteTransport(key routeKey) *http.Transport {
+	tr := key.base.Clone()
+	dial := tr.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	tr.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == key.target {
+			_, port, _ := net.SplitHostPort(address)
+			address = net.JoinHostPort(key.ip, port)
+		}
+		return dial(ctx, network, address)
+	}
+	return tr
+}
@@ -0,0 +1,157 @@
+package retryhttp_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/patrickdappollonio/retryhttp"
+)
+
+// staticResolver resolves every host to the same addresses.
+type staticResolver []string
+
+func (r staticResolver) LookupHost(context.Context, string) ([]string, error) {
+	return r, nil
+}
+
+func TestClient_WithAddressRotation(t *testing.T) {
+	t.Run("Retries dial the next address", func(t *testing.T) {
+		broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer broken.Close()
+		_, port, _ := net.SplitHostPort(broken.Listener.Addr().String())
+
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+		if err != nil {
+			t.Skipf("cannot listen on a second loopback address: %v", err)
+		}
+		var hosts []string
+		healthy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hosts = append(hosts, r.Host)
+		}))
+		healthy.Listener.Close()
+		healthy.Listener = listener
+		healthy.Start()
+		defer healthy.Close()
+
+		var addresses []string
+		client := retryhttp.New(
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithInitialBackoff(0),
+			retryhttp.WithAddressRotation(staticResolver{"127.0.0.2", "127.0.0.1"}),
+			retryhttp.WithOnAttempt(func(info retryhttp.AttemptInfo) {
+				addresses = append(addresses, info.Address)
+			}),
+		)
+
+		resp, err := client.Get("http://api.test:" + port + "/")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		expected := []string{"127.0.0.1:" + port, "127.0.0.2:" + port}
+		if !reflect.DeepEqual(addresses, expected) {
+			t.Fatalf("expected attempts on %v, got %v", expected, addresses)
+		}
+		if expected := []string{"api.test:" + port}; !reflect.DeepEqual(hosts, expected) {
+			t.Fatalf("expected Host headers %v, got %v", expected, hosts)
+		}
+	})
+
+	t.Run("TLS server name is kept", func(t *testing.T) {
+		var serverName, host string
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serverName, host = r.TLS.ServerName, r.Host
+		}))
+		defer srv.Close()
+		_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+		client := retryhttp.New(
+			retryhttp.WithClient(srv.Client()),
+			retryhttp.WithAddressRotation(staticResolver{"127.0.0.1"}),
+		)
+		resp, err := client.Get("https://example.com:" + port + "/")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		if serverName != "example.com" || host != "example.com:"+port {
+			t.Fatalf("expected server name example.com and host example.com:%s, got %q and %q", port, serverName, host)
+		}
+	})
+
+	t.Run("Failed connections are not reused", func(t *testing.T) {
+		var calls, conns atomic.Int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Add(1)
+			}
+		}
+		srv.Start()
+		defer srv.Close()
+		_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+		client := retryhttp.New(
+			retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+			retryhttp.WithInitialBackoff(0),
+			retryhttp.WithAddressRotation(staticResolver{"127.0.0.1"}),
+		)
+		defer client.CloseIdleConnections()
+
+		resp, err := client.Get("http://api.test:" + port + "/")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		if got := conns.Load(); got != 2 {
+			t.Fatalf("expected the retry to open a new connection, got %d connections", got)
+		}
+	})
+
+	t.Run("Requests through a proxy are not rotated", func(t *testing.T) {
+		var proxied []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = append(proxied, r.URL.String())
+		}))
+		defer proxy.Close()
+		proxyURL, _ := url.Parse(proxy.URL)
+
+		var addresses []string
+		client := retryhttp.New(
+			retryhttp.WithClient(&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}),
+			retryhttp.WithAddressRotation(staticResolver{"192.0.2.1", "192.0.2.2"}),
+			retryhttp.WithOnAttempt(func(info retryhttp.AttemptInfo) {
+				addresses = append(addresses, info.Address)
+			}),
+		)
+		defer client.CloseIdleConnections()
+
+		resp, err := client.Get("http://api.test/v1")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+
+		if !reflect.DeepEqual(proxied, []string{"http://api.test/v1"}) {
+			t.Fatalf("expected the request to go through the proxy, got %v", proxied)
+		}
+		if !reflect.DeepEqual(addresses, []string{""}) {
+			t.Fatalf("expected no rotated address, got %q", addresses)
+		}
+	})
+}
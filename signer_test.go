@@ -0,0 +1,98 @@
+package retryhttp_test
+
+import (
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickdappollonio/retryhttp"
+	"github.com/patrickdappollonio/retryhttp/retryhttptest"
+)
+
+func TestClient_WithSigner(t *testing.T) {
+	key := []byte("secret")
+	clock := retryhttptest.NewFakeClock(time.Unix(1_700_000_000, 0))
+
+	// The server verifies every request, rejects expired timestamps and
+	// reused nonces, and fails the first valid request to force a retry.
+	var mu sync.Mutex
+	nonces := make(map[string]bool)
+	var rejections []string
+	valid := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		reject := func(reason string) {
+			rejections = append(rejections, reason)
+			http.Error(w, reason, http.StatusUnauthorized)
+		}
+		if r.Header.Get(retryhttp.HeaderSignatureKeyID) != "key-1" {
+			reject("unknown key")
+			return
+		}
+		if !hmac.Equal([]byte(r.Header.Get(retryhttp.HeaderSignature)), []byte(retryhttp.HMACSignature(key, r, body))) {
+			reject("bad signature")
+			return
+		}
+		ts, _ := strconv.ParseInt(r.Header.Get(retryhttp.HeaderSignatureTimestamp), 10, 64)
+		if clock.Now().Sub(time.Unix(ts, 0)) > time.Minute {
+			reject("signature expired")
+			return
+		}
+		nonce := r.Header.Get(retryhttp.HeaderSignatureNonce)
+		if nonces[nonce] {
+			reject("nonce reused")
+			return
+		}
+		nonces[nonce] = true
+
+		if valid++; valid == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	client := retryhttp.New(
+		retryhttp.WithClient(srv.Client()),
+		retryhttp.WithClock(clock),
+		retryhttp.WithCondition(retryhttp.RetryOnStatuses(http.StatusServiceUnavailable)),
+		retryhttp.WithInitialBackoff(5*time.Minute),
+		retryhttp.WithMaxBackoff(5*time.Minute),
+		retryhttp.WithSigner(&retryhttp.HMACSigner{KeyID: "key-1", Key: key, Clock: clock}),
+	)
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := client.Post(srv.URL+"/v1/orders?dry_run=1", "application/json", strings.NewReader(`{"qty":1}`))
+		done <- result{resp, err}
+	}()
+	clock.BlockUntil(1)
+	clock.AdvanceToNext()
+	res := <-done
+
+	if res.err != nil {
+		t.Fatalf("expected no error, got: %v", res.err)
+	}
+	res.resp.Body.Close()
+	if res.resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry to be accepted, got status %d and rejections %v", res.resp.StatusCode, rejections)
+	}
+	if len(rejections) > 0 {
+		t.Fatalf("expected no rejections, got %v", rejections)
+	}
+	if len(nonces) != 2 {
+		t.Fatalf("expected 2 distinct nonces, got %d", len(nonces))
+	}
+}